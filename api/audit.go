@@ -0,0 +1,105 @@
+package api
+
+import (
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/audit"
+	"deili-backend/internal/client"
+	"deili-backend/internal/guest"
+	"deili-backend/internal/listing"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recordAudit stores audit entries for changes the request made. The changes have already
+// been written, so a failure to record them is logged rather than failing the request.
+func (h *Handler) recordAudit(r *http.Request, entries ...audit.Entry) {
+	if err := h.Audit.Record(r.Context(), entries...); err != nil {
+		log.Printf("Error recording %d audit entries: %v", len(entries), err)
+	}
+}
+
+// clientSnapshot and guestSnapshot are what the audit log records of a client or guest: the
+// API's view, so entries name fields the way responses do. A nil record stays nil.
+func clientSnapshot(c *client.Client) any {
+	if c == nil {
+		return nil
+	}
+	return newClientResponse(*c)
+}
+
+func guestSnapshot(g *guest.Guest) any {
+	if g == nil {
+		return nil
+	}
+	return newGuestResponse(*g)
+}
+
+// GetAuditLog lists the recorded changes to a client and its guests. Besides the parameters
+// read by parseListQuery it takes resource_type (client or guest), resource_id and action;
+// entries can only be sorted by created_at.
+func (h *Handler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	clientID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	values := r.URL.Query()
+	q, err := parseListQuery(values)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if q.SortBy != listing.SortCreated {
+		apperror.Write(w, listing.InvalidParam("sort", "audit entries can only be sorted by %q", listing.SortCreated))
+		return
+	}
+
+	var f audit.Filter
+	switch resourceType := audit.ResourceType(values.Get("resource_type")); resourceType {
+	case "", audit.ResourceClient, audit.ResourceGuest:
+		f.ResourceType = resourceType
+	default:
+		apperror.Write(w, listing.InvalidParam("resource_type", "resource_type must be %q or %q", audit.ResourceClient, audit.ResourceGuest))
+		return
+	}
+	if value := values.Get("resource_id"); value != "" {
+		if f.ResourceID, err = primitive.ObjectIDFromHex(value); err != nil {
+			apperror.Write(w, listing.InvalidParam("resource_id", "resource_id must be a 24 character hex ID"))
+			return
+		}
+	}
+	switch action := audit.Action(values.Get("action")); action {
+	case "", audit.ActionCreate, audit.ActionUpdate, audit.ActionDelete, audit.ActionRestore:
+		f.Action = action
+	default:
+		apperror.Write(w, listing.InvalidParam("action", "unknown action %q", action))
+		return
+	}
+
+	page, err := h.Audit.ListEntries(r.Context(), clientID, f, q)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// recordGuestUpdate audits a guest change made by a store call that does not return the
+// updated guest, reading it back to compare with before. It returns the updated guest.
+func (h *Handler) recordGuestUpdate(r *http.Request, before *guest.Guest) (*guest.Guest, error) {
+	after, err := h.Guests.GetGuestByID(r.Context(), before.ID)
+	if err != nil {
+		log.Printf("Error reading guest %s back for the audit log: %v", before.ID.Hex(), err)
+		return nil, err
+	}
+	h.recordAudit(r, audit.NewEntry(r.Context(), audit.ActionUpdate, audit.ResourceGuest, before.ID, before.ClientID, guestSnapshot(before), guestSnapshot(after)))
+	return after, nil
+}
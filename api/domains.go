@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"deili-backend/config"
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/audit"
+	"deili-backend/internal/auth"
+	"deili-backend/internal/client"
+	"deili-backend/internal/revision"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// dnsTimeout bounds the lookup of a domain's verification record
+const dnsTimeout = 10 * time.Second
+
+// lookupDomain finds the client with a verified custom domain, for the tenant resolver
+func (h *Handler) lookupDomain(ctx context.Context, host string) (primitive.ObjectID, error) {
+	c, err := h.Clients.GetClientByDomain(ctx, host)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return c.ID, nil
+}
+
+// managedClient parses the client ID of a domain route, checks the caller may manage the client
+// and loads it. It writes the error response and returns nil when any step fails.
+func (h *Handler) managedClient(w http.ResponseWriter, r *http.Request) *client.Client {
+	clientID, err := parseObjectID(mux.Vars(r)["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return nil
+	}
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(clientID)) {
+		return nil
+	}
+	existing, err := h.Clients.GetClientByID(r.Context(), clientID)
+	if err != nil {
+		apperror.Write(w, err)
+		return nil
+	}
+	return existing
+}
+
+// GetDomains lists the custom domains of a client
+func (h *Handler) GetDomains(w http.ResponseWriter, r *http.Request) {
+	existing := h.managedClient(w, r)
+	if existing == nil {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newDomainResponses(existing.Domains))
+}
+
+// AddDomain registers a custom domain on a client. The domain stays pending, and is neither
+// served nor allowed by CORS, until VerifyDomain finds its TXT record.
+func (h *Handler) AddDomain(w http.ResponseWriter, r *http.Request) {
+	existing := h.managedClient(w, r)
+	if existing == nil {
+		return
+	}
+
+	var req addDomainRequest
+	if err := decodeJSON(r, &req); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	host, err := client.NormalizeHost(req.Host)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	// Subdomains of the platform are handed out as slugs
+	if domain := strings.ToLower(config.TenantDomain); host == domain || strings.HasSuffix(host, "."+domain) {
+		apperror.Write(w, apperror.InvalidField("host", "must not be under %s; set the slug instead", domain))
+		return
+	}
+	if _, ok := existing.Domain(host); ok {
+		apperror.Write(w, client.ErrDomainTaken)
+		return
+	}
+	if len(existing.Domains) >= client.MaxDomains {
+		apperror.Write(w, apperror.InvalidField("host", "cannot be added, a client has at most %d domains", client.MaxDomains))
+		return
+	}
+
+	d, err := client.NewDomain(host)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	updated, err := h.Clients.AddDomain(r.Context(), existing.ID, d)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	h.recordAudit(r, audit.NewEntry(r.Context(), audit.ActionUpdate, audit.ResourceClient, existing.ID, existing.ID, clientSnapshot(existing), clientSnapshot(updated)))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newDomainResponse(d))
+}
+
+// VerifyDomain looks up the verification record of a custom domain and marks the domain
+// verified when it holds the token, or failed when it does not. A verified domain whose record
+// was removed fails the next check.
+func (h *Handler) VerifyDomain(w http.ResponseWriter, r *http.Request) {
+	existing := h.managedClient(w, r)
+	if existing == nil {
+		return
+	}
+	d, ok := existing.Domain(strings.ToLower(mux.Vars(r)["host"]))
+	if !ok {
+		apperror.Write(w, client.ErrDomainNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), dnsTimeout)
+	defer cancel()
+	found, err := d.Check(ctx, net.DefaultResolver.LookupTXT)
+	if err != nil {
+		log.Printf("Error looking up the verification record of %s: %v", d.Host, err)
+		apperror.Write(w, apperror.New(apperror.CodeUnavailable, "could not look up %s, try again later", d.VerificationRecord()))
+		return
+	}
+	status := client.DomainFailed
+	if found {
+		status = client.DomainVerified
+	}
+
+	updated, err := h.Clients.SetDomainStatus(r.Context(), existing.ID, d.Host, status, revision.Now())
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	h.recordAudit(r, audit.NewEntry(r.Context(), audit.ActionUpdate, audit.ResourceClient, existing.ID, existing.ID, clientSnapshot(existing), clientSnapshot(updated)))
+	h.tenants.Forget(d.Host)
+
+	d, _ = updated.Domain(d.Host)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newDomainResponse(d))
+}
+
+// RemoveDomain drops a custom domain from a client and returns the domains left
+func (h *Handler) RemoveDomain(w http.ResponseWriter, r *http.Request) {
+	existing := h.managedClient(w, r)
+	if existing == nil {
+		return
+	}
+
+	host := strings.ToLower(mux.Vars(r)["host"])
+	updated, err := h.Clients.RemoveDomain(r.Context(), existing.ID, host)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	h.recordAudit(r, audit.NewEntry(r.Context(), audit.ActionUpdate, audit.ResourceClient, existing.ID, existing.ID, clientSnapshot(existing), clientSnapshot(updated)))
+	h.tenants.Forget(host)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newDomainResponses(updated.Domains))
+}
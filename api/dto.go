@@ -0,0 +1,295 @@
+package api
+
+import (
+	"deili-backend/internal/client"
+	"deili-backend/internal/event"
+	"deili-backend/internal/guest"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The API speaks in the request and response types below rather than the storage models, so
+// renaming a Mongo field never changes the JSON and the JSON is snake_case throughout.
+
+// timestamps returns when a record was created and last updated. Records stored before the
+// stores kept timestamps fall back to the time in their ObjectID.
+func timestamps(id primitive.ObjectID, createdAt, updatedAt time.Time) (time.Time, time.Time) {
+	if createdAt.IsZero() {
+		createdAt = id.Timestamp().UTC()
+	}
+	if updatedAt.IsZero() {
+		updatedAt = createdAt
+	}
+	return createdAt, updatedAt
+}
+
+// createClientRequest is the body of POST /clients
+type createClientRequest struct {
+	Name            string `json:"name"`
+	Contact         string `json:"contact"`
+	InvitationTypes string `json:"invitation_types"`
+	Slug            string `json:"slug"`
+}
+
+func (req createClientRequest) client() client.Client {
+	return client.Client{Name: req.Name, Contact: req.Contact, InvitationTypes: req.InvitationTypes, Slug: req.Slug}
+}
+
+// clientResponse is a client as the API returns it
+type clientResponse struct {
+	ID              primitive.ObjectID `json:"id"`
+	Name            string             `json:"name"`
+	Contact         string             `json:"contact"`
+	InvitationTypes string             `json:"invitation_types"`
+	Slug            string             `json:"slug,omitempty"`
+	Domains         []domainResponse   `json:"domains"`
+	CreatedAt       time.Time          `json:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at"`
+	Version         int64              `json:"version"`
+	// DeletedAt is only set on clients listed from the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func newClientResponse(c client.Client) clientResponse {
+	created, updated := timestamps(c.ID, c.CreatedAt, c.UpdatedAt)
+	return clientResponse{
+		ID:              c.ID,
+		Name:            c.Name,
+		Contact:         c.Contact,
+		InvitationTypes: c.InvitationTypes,
+		Slug:            c.Slug,
+		Domains:         newDomainResponses(c.Domains),
+		CreatedAt:       created,
+		UpdatedAt:       updated,
+		Version:         c.Version,
+		DeletedAt:       c.DeletedAt,
+	}
+}
+
+// addDomainRequest is the body of POST /clients/{id}/domains
+type addDomainRequest struct {
+	Host string `json:"host"`
+}
+
+// domainResponse is a custom domain as the API returns it, with the DNS record the couple has
+// to publish to verify it
+type domainResponse struct {
+	Host               string                     `json:"host"`
+	Status             client.DomainStatus        `json:"status"`
+	VerificationRecord verificationRecordResponse `json:"verification_record"`
+	AddedAt            time.Time                  `json:"added_at"`
+	CheckedAt          *time.Time                 `json:"checked_at,omitempty"`
+	VerifiedAt         *time.Time                 `json:"verified_at,omitempty"`
+}
+
+// verificationRecordResponse is the TXT record proving a couple controls a domain
+type verificationRecordResponse struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+func newDomainResponse(d client.Domain) domainResponse {
+	return domainResponse{
+		Host:               d.Host,
+		Status:             d.Status,
+		VerificationRecord: verificationRecordResponse{Name: d.VerificationRecord(), Type: "TXT", Value: d.VerificationToken},
+		AddedAt:            d.AddedAt,
+		CheckedAt:          d.CheckedAt,
+		VerifiedAt:         d.VerifiedAt,
+	}
+}
+
+// newDomainResponses never returns nil, so clients without domains list an empty array
+func newDomainResponses(domains []client.Domain) []domainResponse {
+	responses := make([]domainResponse, 0, len(domains))
+	for _, d := range domains {
+		responses = append(responses, newDomainResponse(d))
+	}
+	return responses
+}
+
+// siteResponse is the public view of a client, for the couple's site
+type siteResponse struct {
+	ID              primitive.ObjectID `json:"id"`
+	Slug            string             `json:"slug,omitempty"`
+	Name            string             `json:"name"`
+	InvitationTypes string             `json:"invitation_types"`
+}
+
+func newSiteResponse(c client.Client) siteResponse {
+	return siteResponse{ID: c.ID, Slug: c.Slug, Name: c.Name, InvitationTypes: c.InvitationTypes}
+}
+
+// createGuestRequest is the body of the public RSVP form, POST /guests. RSVPs sent from a
+// personalized link carry invitation_token instead of client_id, and RSVPs sent from the
+// couple's site may leave client_id out.
+type createGuestRequest struct {
+	ClientID        string                   `json:"client_id"`
+	InvitationToken string                   `json:"invitation_token"`
+	Name            string                   `json:"name"`
+	Message         string                   `json:"message"`
+	Confirmation    guest.ConfirmationStatus `json:"confirmation"`
+	PartySize       int                      `json:"party_size"`
+	PlusOnes        []string                 `json:"plus_ones"`
+	// Website is the honeypot field, see honeypotField
+	Website string `json:"website"`
+}
+
+// guest returns the RSVP as a guest; invitation tokens, party size limits and event
+// invitations are only set by the couple, so the request cannot carry them
+func (req createGuestRequest) guest() guest.Guest {
+	return guest.Guest{
+		Name:         req.Name,
+		Message:      req.Message,
+		Confirmation: req.Confirmation,
+		PartySize:    req.PartySize,
+		PlusOnes:     req.PlusOnes,
+	}
+}
+
+// guestResponse is a guest as the API returns it
+type guestResponse struct {
+	ID                primitive.ObjectID       `json:"id"`
+	ClientID          primitive.ObjectID       `json:"client_id"`
+	Name              string                   `json:"name"`
+	Message           string                   `json:"message"`
+	Confirmation      guest.ConfirmationStatus `json:"confirmation"`
+	MessageStatus     guest.MessageStatus      `json:"message_status,omitempty"`
+	MessageHoldReason string                   `json:"message_hold_reason,omitempty"`
+	PartySize         int                      `json:"party_size"`
+	PlusOnes          []string                 `json:"plus_ones"`
+	MaxPartySize      int                      `json:"max_party_size"`
+	RespondedAt       *time.Time               `json:"responded_at,omitempty"`
+	InvitedEventIDs   []primitive.ObjectID     `json:"invited_event_ids"`
+	EventRSVPs        []guest.EventRSVP        `json:"event_rsvps"`
+	Phone             string                   `json:"phone,omitempty"`
+	Group             string                   `json:"group,omitempty"`
+	InvitationToken   string                   `json:"invitation_token,omitempty"`
+	CreatedAt         time.Time                `json:"created_at"`
+	UpdatedAt         time.Time                `json:"updated_at"`
+	Version           int64                    `json:"version"`
+	// DeletedAt is only set on guests listed from the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func newGuestResponse(g guest.Guest) guestResponse {
+	created, updated := timestamps(g.ID, g.CreatedAt, g.UpdatedAt)
+	resp := guestResponse{
+		ID:                g.ID,
+		ClientID:          g.ClientID,
+		Name:              g.Name,
+		Message:           g.Message,
+		Confirmation:      g.Confirmation,
+		MessageStatus:     g.MessageStatus,
+		MessageHoldReason: g.MessageHoldReason,
+		PartySize:         g.PartySize,
+		PlusOnes:          g.PlusOnes,
+		MaxPartySize:      g.EffectiveMaxPartySize(),
+		InvitedEventIDs:   g.InvitedEventIDs,
+		EventRSVPs:        g.EventRSVPs,
+		Phone:             g.Phone,
+		Group:             g.Group,
+		InvitationToken:   g.InvitationToken,
+		CreatedAt:         created,
+		UpdatedAt:         updated,
+		Version:           g.Version,
+		DeletedAt:         g.DeletedAt,
+	}
+	if !g.RespondedAt.IsZero() {
+		respondedAt := g.RespondedAt
+		resp.RespondedAt = &respondedAt
+	}
+	// Lists are never null, so clients can iterate them without checking
+	if resp.PlusOnes == nil {
+		resp.PlusOnes = []string{}
+	}
+	if resp.InvitedEventIDs == nil {
+		resp.InvitedEventIDs = []primitive.ObjectID{}
+	}
+	if resp.EventRSVPs == nil {
+		resp.EventRSVPs = []guest.EventRSVP{}
+	}
+	return resp
+}
+
+// createGuestResponse is a new or answered RSVP with the guest's own edit token
+type createGuestResponse struct {
+	guestResponse
+	GuestToken string `json:"guest_token"`
+}
+
+// eventRSVPRequest is the body of PUT /guests/{id}/events/{event_id}
+type eventRSVPRequest struct {
+	Confirmation guest.ConfirmationStatus `json:"confirmation"`
+	PartySize    int                      `json:"party_size"`
+}
+
+// eventRequest is the body of POST /clients/{id}/events and PUT /events/{id}
+type eventRequest struct {
+	Name      string      `json:"name"`
+	StartsAt  time.Time   `json:"starts_at"`
+	EndsAt    time.Time   `json:"ends_at"`
+	TimeZone  string      `json:"time_zone"`
+	Venue     event.Venue `json:"venue"`
+	DressCode string      `json:"dress_code"`
+	Capacity  int         `json:"capacity"`
+}
+
+func (req eventRequest) event(clientID primitive.ObjectID) event.Event {
+	return event.Event{
+		ClientID:  clientID,
+		Name:      req.Name,
+		StartsAt:  req.StartsAt,
+		EndsAt:    req.EndsAt,
+		TimeZone:  req.TimeZone,
+		Venue:     req.Venue,
+		DressCode: req.DressCode,
+		Capacity:  req.Capacity,
+	}
+}
+
+// eventResponse is an event as the API returns it
+type eventResponse struct {
+	ID        primitive.ObjectID `json:"id"`
+	ClientID  primitive.ObjectID `json:"client_id"`
+	Name      string             `json:"name"`
+	StartsAt  time.Time          `json:"starts_at"`
+	EndsAt    time.Time          `json:"ends_at"`
+	TimeZone  string             `json:"time_zone"`
+	Venue     event.Venue        `json:"venue"`
+	DressCode string             `json:"dress_code,omitempty"`
+	Capacity  int                `json:"capacity,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+	Version   int64              `json:"version"`
+}
+
+func newEventResponse(e event.Event) eventResponse {
+	created, updated := timestamps(e.ID, e.CreatedAt, e.UpdatedAt)
+	return eventResponse{
+		ID:        e.ID,
+		ClientID:  e.ClientID,
+		Name:      e.Name,
+		StartsAt:  e.StartsAt,
+		EndsAt:    e.EndsAt,
+		TimeZone:  e.TimeZone,
+		Venue:     e.Venue,
+		DressCode: e.DressCode,
+		Capacity:  e.Capacity,
+		CreatedAt: created,
+		UpdatedAt: updated,
+		Version:   e.Version,
+	}
+}
+
+// deleteEventResponse reports how many events a delete removed
+type deleteEventResponse struct {
+	DeletedEvents int64 `json:"deleted_events"`
+}
+
+// deleteGuestResponse reports how many guests a delete moved to the trash
+type deleteGuestResponse struct {
+	DeletedGuests int64 `json:"deleted_guests"`
+}
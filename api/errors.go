@@ -0,0 +1,32 @@
+package api
+
+import (
+	"deili-backend/internal/apperror"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// parseObjectID reads a hex ObjectID from a path or query parameter
+func parseObjectID(value, param string) (primitive.ObjectID, error) {
+	id, err := primitive.ObjectIDFromHex(value)
+	if err != nil {
+		return id, apperror.InvalidField(param, "must be a 24 character hex ID")
+	}
+	return id, nil
+}
+
+// decodeJSON decodes the request body into v, reporting malformed JSON as a validation error
+func decodeJSON(r *http.Request, v any) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return nil
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return apperror.New(apperror.CodePayloadTooLarge, "request body exceeds %d bytes", tooLarge.Limit)
+	}
+	return apperror.Validation("invalid request payload: %v", err)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/revision"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag is the entity tag of a record at version; any change to the record bumps its version
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// setETag tags a response describing a single record with the record's version
+func setETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", etag(version))
+}
+
+// checkIfMatch enforces the request's If-Match header against the version of the record the
+// handler just read. Requests without the header are not conditional.
+func checkIfMatch(r *http.Request, version int64) error {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == current {
+			return nil
+		}
+	}
+	return apperror.PreconditionFailed("the record has changed since it was read, its current ETag is %s", current)
+}
+
+// versionConflict turns a store's revision.ErrConflict into 412 for requests sent with
+// If-Match: their precondition held when checked, but the record changed before the write
+func versionConflict(r *http.Request, err error) error {
+	if errors.Is(err, revision.ErrConflict) && r.Header.Get("If-Match") != "" {
+		return apperror.PreconditionFailed("the record has changed since it was read")
+	}
+	return err
+}
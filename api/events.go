@@ -0,0 +1,403 @@
+package api
+
+import (
+	"context"
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/auth"
+	"deili-backend/internal/client"
+	"deili-backend/internal/event"
+	"deili-backend/internal/guest"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// errEventNotOwned is returned when an event ID belongs to a different client than the guest
+var errEventNotOwned = errors.New("event does not belong to this client")
+
+// CreateEvent adds an event to a client
+func (h *Handler) CreateEvent(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	clientID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(clientID)) {
+		return
+	}
+
+	var req eventRequest
+	if err := decodeJSON(r, &req); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	newEvent := req.event(clientID)
+
+	if _, err := h.Clients.GetClientByID(r.Context(), clientID); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	result, err := h.Events.CreateEvent(r.Context(), newEvent)
+	if err != nil {
+		log.Printf("Error creating event: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+	eventID, _ := result.InsertedID.(primitive.ObjectID)
+	created, err := h.Events.GetEventByID(r.Context(), eventID)
+	if err != nil {
+		log.Printf("Error reading created event %s: %v", eventID.Hex(), err)
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, created.Version)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newEventResponse(*created))
+}
+
+// GetEventsByClient lists a client's events; they are public so the invitation page can show them
+func (h *Handler) GetEventsByClient(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	clientID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	// The events of a client in the trash stay hidden until it is restored
+	if _, err := h.Clients.GetClientByID(r.Context(), clientID); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	events, err := h.Events.GetEventsByClient(r.Context(), clientID)
+	if err != nil {
+		log.Printf("Error fetching events: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+	items := make([]eventResponse, len(events))
+	for i, e := range events {
+		items[i] = newEventResponse(e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// GetEventByID retrieves a single event
+func (h *Handler) GetEventByID(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	eventID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	eventData, err := h.liveEvent(r.Context(), eventID)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, eventData.Version)
+	json.NewEncoder(w).Encode(newEventResponse(*eventData))
+}
+
+// UpdateEvent replaces an event's details and returns the updated event
+func (h *Handler) UpdateEvent(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	eventID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	existingEvent, err := h.liveEvent(r.Context(), eventID)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(existingEvent.ClientID)) {
+		return
+	}
+	if err := checkIfMatch(r, existingEvent.Version); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	var req eventRequest
+	if err := decodeJSON(r, &req); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	// The write is based on the version read above, so a concurrent change is not overwritten
+	next := req.event(existingEvent.ClientID)
+	next.Version = existingEvent.Version
+	if _, err := h.Events.UpdateEvent(r.Context(), eventID, next); err != nil {
+		log.Printf("Error updating event: %v", err)
+		apperror.Write(w, versionConflict(r, err))
+		return
+	}
+	updated, err := h.Events.GetEventByID(r.Context(), eventID)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, updated.Version)
+	json.NewEncoder(w).Encode(newEventResponse(*updated))
+}
+
+// DeleteEvent removes an event and the RSVPs given for it
+func (h *Handler) DeleteEvent(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	eventID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	existingEvent, err := h.liveEvent(r.Context(), eventID)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(existingEvent.ClientID)) {
+		return
+	}
+	if err := checkIfMatch(r, existingEvent.Version); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	// The write is based on the version read above, so a concurrent change is not lost
+	result, err := h.Events.DeleteEvent(r.Context(), eventID, existingEvent.Version)
+	if err != nil {
+		apperror.Write(w, versionConflict(r, err))
+		return
+	}
+	if err := h.Guests.RemoveEvent(r.Context(), eventID); err != nil {
+		log.Printf("Error removing RSVPs for deleted event %s: %v", eventID.Hex(), err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deleteEventResponse{DeletedEvents: result.DeletedCount})
+}
+
+// SetGuestEvents controls which of the client's events a guest is invited to and returns the
+// updated guest
+func (h *Handler) SetGuestEvents(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	guestID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	existingGuest, err := h.Guests.GetGuestByID(r.Context(), guestID)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(existingGuest.ClientID)) {
+		return
+	}
+	if err := checkIfMatch(r, existingGuest.Version); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	var body struct {
+		EventIDs []primitive.ObjectID `json:"event_ids"`
+	}
+	if err := decodeJSON(r, &body); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if err := h.validateEventIDs(r.Context(), existingGuest.ClientID, body.EventIDs); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	if _, err := h.Guests.SetInvitedEvents(r.Context(), guestID, existingGuest.Version, body.EventIDs); err != nil {
+		log.Printf("Error setting guest events: %v", err)
+		apperror.Write(w, versionConflict(r, err))
+		return
+	}
+	// Answers for the events the guest is no longer invited to were dropped with their seats
+	invited := *existingGuest
+	invited.InvitedEventIDs = body.EventIDs
+	var dropped []guest.EventRSVP
+	for _, rsvp := range existingGuest.EventRSVPs {
+		if !invited.IsInvitedTo(rsvp.EventID) {
+			dropped = append(dropped, rsvp)
+		}
+	}
+	h.giveBackSeats(r.Context(), dropped)
+	updated, err := h.recordGuestUpdate(r, existingGuest)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, updated.Version)
+	json.NewEncoder(w).Encode(newGuestResponse(*updated))
+}
+
+// SetEventRSVP records a guest's answer for one event, enforcing the event's capacity, and
+// returns the updated guest
+func (h *Handler) SetEventRSVP(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	guestID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	eventID, err := parseObjectID(params["event_id"], "event_id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	existingGuest, err := h.Guests.GetGuestByID(r.Context(), guestID)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanAccessGuest(existingGuest.ID, existingGuest.ClientID)) {
+		return
+	}
+	if err := checkIfMatch(r, existingGuest.Version); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	eventData, err := h.Events.GetEventByID(r.Context(), eventID)
+	if err == nil && eventData.ClientID != existingGuest.ClientID {
+		err = event.ErrNotFound
+	}
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	var req eventRSVPRequest
+	if err := decodeJSON(r, &req); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	rsvp := guest.EventRSVP{EventID: eventID, Confirmation: req.Confirmation, PartySize: req.PartySize}
+	if err := guest.NormalizeEventRSVP(*existingGuest, &rsvp); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	// The event's seat counter moves by the change in the guest's party. Extra seats are taken
+	// with one conditional write before the answer is stored, so two guests cannot both take
+	// the last ones; seats are only given back once the answer is stored.
+	previous, _ := existingGuest.EventRSVP(eventID)
+	seats := rsvp.Seats() - previous.Seats()
+	err = h.Tx.WithTransaction(r.Context(), func(ctx context.Context) error {
+		if seats > 0 {
+			if err := h.Events.TakeSeats(ctx, eventID, seats); err != nil {
+				return err
+			}
+		}
+		if _, err := h.Guests.SetEventRSVP(ctx, guestID, existingGuest.Version, rsvp); err != nil {
+			if seats > 0 {
+				h.giveBackSeats(ctx, []guest.EventRSVP{{EventID: eventID, Confirmation: guest.StatusAttending, PartySize: seats}})
+			}
+			return err
+		}
+		if seats < 0 {
+			h.giveBackSeats(ctx, []guest.EventRSVP{{EventID: eventID, Confirmation: guest.StatusAttending, PartySize: -seats}})
+		}
+		return nil
+	})
+	if errors.Is(err, event.ErrFull) {
+		if current, getErr := h.Events.GetEventByID(r.Context(), eventID); getErr == nil {
+			left := max(current.Capacity-current.SeatsTaken, 0)
+			err = apperror.Conflict("%s is full: %d of %d seats remain", current.Name, left, current.Capacity).Wrap(event.ErrFull)
+		}
+	}
+	if err != nil {
+		log.Printf("Error recording event RSVP: %v", err)
+		apperror.Write(w, versionConflict(r, err))
+		return
+	}
+	updated, err := h.recordGuestUpdate(r, existingGuest)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, updated.Version)
+	json.NewEncoder(w).Encode(newGuestResponse(*updated))
+}
+
+// giveBackSeats returns the seats held by rsvps to their events. A failure only leaves seats
+// counted as taken, so it is logged rather than failing a write that already happened.
+func (h *Handler) giveBackSeats(ctx context.Context, rsvps []guest.EventRSVP) {
+	h.moveSeats(ctx, rsvps, -1)
+}
+
+// moveSeats adds the seats held by rsvps to their events, or takes them off when sign is -1.
+// Capacity is not checked, and events deleted since are skipped.
+func (h *Handler) moveSeats(ctx context.Context, rsvps []guest.EventRSVP, sign int) {
+	for _, rsvp := range rsvps {
+		if rsvp.Seats() == 0 {
+			continue
+		}
+		err := h.Events.AddSeats(ctx, rsvp.EventID, sign*rsvp.Seats())
+		if err != nil && !errors.Is(err, event.ErrNotFound) {
+			log.Printf("Error updating the seats taken at event %s: %v", rsvp.EventID.Hex(), err)
+		}
+	}
+}
+
+// liveEvent retrieves an event, treating the events of a client in the trash as not found so
+// they stay untouched until the client is restored
+func (h *Handler) liveEvent(ctx context.Context, id primitive.ObjectID) (*event.Event, error) {
+	e, err := h.Events.GetEventByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := h.Clients.GetClientByID(ctx, e.ClientID); err != nil {
+		if errors.Is(err, client.ErrNotFound) {
+			return nil, event.ErrNotFound
+		}
+		return nil, err
+	}
+	return e, nil
+}
+
+// validateEventIDs checks that every event exists and belongs to the client
+func (h *Handler) validateEventIDs(ctx context.Context, clientID primitive.ObjectID, eventIDs []primitive.ObjectID) error {
+	for _, id := range eventIDs {
+		e, err := h.Events.GetEventByID(ctx, id)
+		if errors.Is(err, event.ErrNotFound) {
+			return apperror.InvalidField("event_ids", "event %s does not exist", id.Hex())
+		}
+		if err != nil {
+			return err
+		}
+		if e.ClientID != clientID {
+			return apperror.InvalidField("event_ids", "%v: %s", errEventNotOwned, id.Hex()).Wrap(errEventNotOwned)
+		}
+	}
+	return nil
+}
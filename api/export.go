@@ -0,0 +1,188 @@
+package api
+
+import (
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/auth"
+	"deili-backend/internal/export"
+	"deili-backend/internal/guest"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// guestColumn is one selectable column of the guest export
+type guestColumn struct {
+	export.Column
+	value func(g guest.Guest, loc *time.Location) string
+}
+
+// guestColumnOrder is the order columns appear in when all of them are selected
+var guestColumnOrder = []string{
+	"id", "name", "phone", "group", "confirmation", "party_size", "plus_ones", "max_party_size", "message", "invited", "responded_at",
+}
+
+// defaultGuestColumns are exported when the request does not pick any
+var defaultGuestColumns = []string{"name", "confirmation", "party_size", "plus_ones", "message", "responded_at"}
+
+var guestColumns = map[string]guestColumn{
+	"id": {export.Column{Header: "ID"}, func(g guest.Guest, _ *time.Location) string {
+		return g.ID.Hex()
+	}},
+	"name": {export.Column{Header: "Name"}, func(g guest.Guest, _ *time.Location) string {
+		return g.Name
+	}},
+	"phone": {export.Column{Header: "Phone"}, func(g guest.Guest, _ *time.Location) string {
+		return g.Phone
+	}},
+	"group": {export.Column{Header: "Group"}, func(g guest.Guest, _ *time.Location) string {
+		return g.Group
+	}},
+	"confirmation": {export.Column{Header: "Confirmation"}, func(g guest.Guest, _ *time.Location) string {
+		return string(g.Confirmation)
+	}},
+	"party_size": {export.Column{Header: "Party Size", Numeric: true}, func(g guest.Guest, _ *time.Location) string {
+		return strconv.Itoa(g.PartySize)
+	}},
+	"plus_ones": {export.Column{Header: "Plus-ones"}, func(g guest.Guest, _ *time.Location) string {
+		return strings.Join(g.PlusOnes, ", ")
+	}},
+	"max_party_size": {export.Column{Header: "Max Party Size", Numeric: true}, func(g guest.Guest, _ *time.Location) string {
+		return strconv.Itoa(g.EffectiveMaxPartySize())
+	}},
+	"message": {export.Column{Header: "Message"}, func(g guest.Guest, _ *time.Location) string {
+		return g.Message
+	}},
+	"invited": {export.Column{Header: "Invited"}, func(g guest.Guest, _ *time.Location) string {
+		if g.InvitationToken != "" {
+			return "yes"
+		}
+		return "no"
+	}},
+	"responded_at": {export.Column{Header: "Responded At"}, func(g guest.Guest, loc *time.Location) string {
+		if g.RespondedAt.IsZero() {
+			return ""
+		}
+		return g.RespondedAt.In(loc).Format("2006-01-02 15:04:05")
+	}},
+}
+
+// ExportGuests streams a client's guest list as CSV or XLSX.
+//
+// Query parameters: client_id (required), format (csv or xlsx, default csv), columns
+// (comma-separated, see guestColumnOrder, or "all"), status (comma-separated confirmation
+// statuses) and tz (IANA time zone for responded_at, default UTC).
+func (h *Handler) ExportGuests(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	clientID, err := parseObjectID(query.Get("client_id"), "client_id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(clientID)) {
+		return
+	}
+
+	format, err := export.ParseFormat(query.Get("format"))
+	if err != nil {
+		apperror.Write(w, apperror.InvalidField("format", "%v", err))
+		return
+	}
+
+	selected, err := parseGuestColumns(query.Get("columns"))
+	if err != nil {
+		apperror.Write(w, apperror.InvalidField("columns", "%v", err))
+		return
+	}
+
+	statuses, err := parseStatusFilter(query.Get("status"))
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	loc, err := parseTimeZone(query.Get("tz"))
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	clientData, err := h.Clients.GetClientByID(r.Context(), clientID)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	columns := make([]export.Column, len(selected))
+	for i, c := range selected {
+		columns[i] = c.Column
+	}
+
+	// Large exports outlast the server's WriteTimeout, so the response gets as long as the cursor
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(guest.ExportTimeout)); err != nil {
+		log.Printf("Error extending the write deadline of a guest export: %v", err)
+	}
+
+	// mime.FormatMediaType switches to RFC 2231 encoding for non-ASCII client names
+	filename := fmt.Sprintf("guests-%s.%s", clientData.Name, format)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	writer, err := export.NewWriter(format, w, clientData.Name, columns)
+	if err != nil {
+		log.Printf("Error starting guest export: %v", err)
+		return
+	}
+
+	// Headers are already sent, so a failure midway can only be logged
+	row := make([]string, len(selected))
+	err = h.Guests.ForEachGuest(r.Context(), clientID, statuses, func(g guest.Guest) error {
+		for i, c := range selected {
+			row[i] = c.value(g, loc)
+		}
+		return writer.Write(row)
+	})
+	if err != nil {
+		log.Printf("Error streaming guest export for client %s: %v", clientID.Hex(), err)
+		return
+	}
+	if err := writer.Close(); err != nil {
+		log.Printf("Error finishing guest export for client %s: %v", clientID.Hex(), err)
+	}
+}
+
+// parseGuestColumns resolves the comma-separated column selection
+func parseGuestColumns(value string) ([]guestColumn, error) {
+	names := splitList(value)
+	switch {
+	case len(names) == 0:
+		names = defaultGuestColumns
+	case len(names) == 1 && names[0] == "all":
+		names = guestColumnOrder
+	}
+
+	columns := make([]guestColumn, 0, len(names))
+	for _, name := range names {
+		c, ok := guestColumns[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown column %q, choose from %s", name, strings.Join(guestColumnOrder, ", "))
+		}
+		columns = append(columns, c)
+	}
+	return columns, nil
+}
+
+// splitList splits a comma-separated query value, dropping blanks
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, strings.ToLower(item))
+		}
+	}
+	return items
+}
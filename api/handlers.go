@@ -1,43 +1,173 @@
 package api
 
 import (
-	"bytes"
+	"context"
+	"deili-backend/config"
+	"deili-backend/database"
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/audit"
+	"deili-backend/internal/auth"
 	"deili-backend/internal/client"
+	"deili-backend/internal/event"
 	"deili-backend/internal/guest"
+	"deili-backend/internal/idempotency"
+	"deili-backend/internal/patch"
+	"deili-backend/internal/requestid"
+	"deili-backend/internal/revision"
+	"deili-backend/internal/tenant"
 	"encoding/json"
-	"fmt"
-	"io"
 	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func RegisterRoutes(r *mux.Router) {
+// Handler serves the HTTP API on top of the injected stores
+type Handler struct {
+	Clients client.ClientStore
+	Guests  guest.GuestStore
+	Events  event.EventStore
+	// Audit records every change the handlers make to clients and guests
+	Audit audit.Store
+	// Idempotency keeps POST responses so retries with the same Idempotency-Key are not processed twice
+	Idempotency idempotency.Store
+	// Tx groups store operations that must succeed or fail together
+	Tx   database.Transactor
+	Auth *auth.Authenticator
+
+	// rsvp rate limits and deduplicates public RSVPs
+	rsvp *rsvpGuard
+	// tenants resolves the couple a request is for from the site it comes from
+	tenants *tenant.Resolver
+}
+
+// NewHandler returns a Handler using the given stores, audit log, idempotency records,
+// transaction runner and authenticator
+func NewHandler(clients client.ClientStore, guests guest.GuestStore, events event.EventStore, auditLog audit.Store, idempotencyKeys idempotency.Store, tx database.Transactor, authenticator *auth.Authenticator) *Handler {
+	h := &Handler{
+		Clients:     clients,
+		Guests:      guests,
+		Events:      events,
+		Audit:       auditLog,
+		Idempotency: idempotencyKeys,
+		Tx:          tx,
+		Auth:        authenticator,
+		rsvp:        newRSVPGuard(),
+	}
+	h.tenants = tenant.NewResolver(config.TenantDomain, h.lookupSite, h.lookupDomain)
+	return h
+}
+
+// APIPrefix is where the current version of the API is mounted
+const APIPrefix = "/api/v1"
+
+// RegisterRoutes mounts the API under APIPrefix. The same routes stay available without the
+// prefix for frontends built before versioning; those responses announce the deprecation.
+func RegisterRoutes(r *mux.Router, h *Handler) {
+	// Every request gets an ID and a principal; handlers decide what it may access
+	r.Use(requestid.Middleware)
+	r.Use(auth.Middleware(h.Auth))
+	// Requests from a couple's site know which client they are for
+	r.Use(h.tenants.Middleware)
+	// Retried POSTs carrying the same Idempotency-Key get the first response back
+	r.Use(idempotency.Middleware(h.Idempotency, config.IdempotencyTTL))
+
+	// Unknown routes answer with the same JSON errors as the handlers
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apperror.Write(w, apperror.New(apperror.CodeNotFound, "no route for %s", r.URL.Path))
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apperror.Write(w, apperror.New(apperror.CodeMethodNotAllowed, "%s is not allowed on %s", r.Method, r.URL.Path))
+	})
+
+	// Both sets of routes live on r itself: mux loses method mismatches inside subrouters and
+	// would answer 404 instead of 405
+	h.routes(r, APIPrefix, nil)
+	h.routes(r, "", deprecatedAlias)
+}
+
+// deprecatedAlias marks responses served on an unversioned path and points to the versioned one
+func deprecatedAlias(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+APIPrefix+r.URL.Path+">; rel=\"successor-version\"")
+		next(w, r)
+	}
+}
+
+// routes registers every API route on r under prefix, wrapping the handlers with wrap when it
+// is set. Each route needs an entry in openapi.json, where paths are relative to APIPrefix.
+func (h *Handler) routes(r *mux.Router, prefix string, wrap func(http.HandlerFunc) http.HandlerFunc) {
+	handle := func(path string, f http.HandlerFunc) *mux.Route {
+		if wrap != nil {
+			f = wrap(f)
+		}
+		return r.HandleFunc(prefix+path, f)
+	}
+
+	handle("/openapi.json", h.GetOpenAPISpec).Methods("GET")
+
 	// Client routes
-	r.HandleFunc("/clients", CreateClient).Methods("POST")
-	r.HandleFunc("/clients", GetClients).Methods("GET")
-	r.HandleFunc("/clients/{id}", GetClientByID).Methods("GET")
-	r.HandleFunc("/clients/{id}", UpdateClient).Methods("PUT")
-	r.HandleFunc("/clients/{id}", DeleteClient).Methods("DELETE")
+	handle("/clients", auth.RequireAdmin(h.CreateClient)).Methods("POST")
+	handle("/clients", auth.RequireAdmin(h.GetClients)).Methods("GET")
+	handle("/clients/{id}", h.GetClientByID).Methods("GET")
+	handle("/clients/{id}", h.UpdateClient).Methods("PATCH", "PUT")
+	handle("/clients/{id}", auth.RequireAdmin(h.DeleteClient)).Methods("DELETE")
+	handle("/clients/{id}/restore", auth.RequireAdmin(h.RestoreClient)).Methods("POST")
+	handle("/clients/{id}/tokens", auth.RequireAdmin(h.IssueOwnerToken)).Methods("POST")
+	handle("/clients/{id}/invitees", h.CreateInvitee).Methods("POST")
+	handle("/clients/{id}/invitees", h.GetInvitees).Methods("GET")
+	handle("/clients/{id}/guests/import", h.ImportGuests).Methods("POST")
+	handle("/clients/{id}/events", h.CreateEvent).Methods("POST")
+	handle("/clients/{id}/events", h.GetEventsByClient).Methods("GET")
+	handle("/clients/{id}/stats", h.GetClientStats).Methods("GET")
+	handle("/clients/{id}/audit", auth.RequireAdmin(h.GetAuditLog)).Methods("GET")
+	handle("/clients/{id}/messages", h.GetMessages).Methods("GET")
+	handle("/clients/{id}/messages/queue", h.GetMessageQueue).Methods("GET")
+	handle("/clients/{id}/domains", h.GetDomains).Methods("GET")
+	handle("/clients/{id}/domains", h.AddDomain).Methods("POST")
+	handle("/clients/{id}/domains/{host}/verify", h.VerifyDomain).Methods("POST")
+	handle("/clients/{id}/domains/{host}", h.RemoveDomain).Methods("DELETE")
+
+	// Public site routes
+	handle("/site", h.GetSite).Methods("GET")
+	handle("/sites/{slug}", h.GetSiteBySlug).Methods("GET")
+
+	// Event routes
+	handle("/events/{id}", h.GetEventByID).Methods("GET")
+	handle("/events/{id}", h.UpdateEvent).Methods("PUT")
+	handle("/events/{id}", h.DeleteEvent).Methods("DELETE")
+
+	// Public invitation routes
+	handle("/invitations/{token}", h.GetInvitation).Methods("GET")
 
 	// Guest routes
-	r.HandleFunc("/guests", CreateGuest).Methods("POST")
-	r.HandleFunc("/guests/{id}", GetGuestByID).Methods("GET")
-	r.HandleFunc("/guests", GetGuestsByClient).Methods("GET")
-	r.HandleFunc("/guests/{id}", UpdateGuest).Methods("PUT")
-	r.HandleFunc("/guests/{id}", DeleteGuest).Methods("DELETE")
+	handle("/guests", h.limitRSVP(h.CreateGuest)).Methods("POST")
+	handle("/guests/export", h.ExportGuests).Methods("GET")
+	handle("/guests/{id}", h.GetGuestByID).Methods("GET")
+	handle("/guests", h.GetGuestsByClient).Methods("GET")
+	handle("/guests/{id}", h.UpdateGuest).Methods("PATCH", "PUT")
+	handle("/guests/{id}", h.DeleteGuest).Methods("DELETE")
+	handle("/guests/{id}/events", h.SetGuestEvents).Methods("PUT")
+	handle("/guests/{id}/events/{event_id}", h.SetEventRSVP).Methods("PUT")
+	handle("/guests/{id}/restore", auth.RequireAdmin(h.RestoreGuest)).Methods("POST")
+	handle("/guests/{id}/moderation", h.ModerateMessage).Methods("PUT")
+
+	// Admin trash routes
+	handle("/trash/clients", auth.RequireAdmin(h.GetDeletedClients)).Methods("GET")
+	handle("/trash/guests", auth.RequireAdmin(h.GetDeletedGuests)).Methods("GET")
 }
 
-func CreateClient(w http.ResponseWriter, r *http.Request) {
-	var newClient client.Client
-	if err := json.NewDecoder(r.Body).Decode(&newClient); err != nil {
+// CreateClient registers a new client and returns it
+func (h *Handler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	var req createClientRequest
+	if err := decodeJSON(r, &req); err != nil {
 		log.Printf("Error decoding request body: %v", err)
-		http.Error(w, fmt.Sprintf("Invalid request payload: %v", err), http.StatusBadRequest)
+		apperror.Write(w, err)
 		return
 	}
+	newClient := req.client()
 
 	// Log the received client data
 	log.Printf("Received client data: %+v", newClient)
@@ -45,268 +175,487 @@ func CreateClient(w http.ResponseWriter, r *http.Request) {
 	// Validate InvitationTypes
 	if newClient.InvitationTypes == "" {
 		log.Printf("InvitationTypes is empty, request will be rejected")
-		http.Error(w, "InvitationTypes cannot be empty", http.StatusBadRequest)
+		apperror.Write(w, apperror.InvalidField("invitation_types", "cannot be empty"))
 		return
 	}
 
 	// Insert the new client into the database
-	result, err := client.CreateClient(newClient)
+	result, err := h.Clients.CreateClient(r.Context(), newClient)
 	if err != nil {
 		log.Printf("Failed to create client: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to create client: %v", err), http.StatusInternalServerError)
+		apperror.Write(w, err)
 		return
 	}
 
 	// Log the created client result
 	log.Printf("Created client result: %+v", result)
+	clientID, _ := result.InsertedID.(primitive.ObjectID)
+	created, err := h.Clients.GetClientByID(r.Context(), clientID)
+	if err != nil {
+		log.Printf("Error reading created client %s: %v", clientID.Hex(), err)
+		apperror.Write(w, err)
+		return
+	}
+	h.recordAudit(r, audit.NewEntry(r.Context(), audit.ActionCreate, audit.ResourceClient, clientID, clientID, nil, clientSnapshot(created)))
+	h.tenants.Forget(created.Slug)
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	setETag(w, created.Version)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newClientResponse(*created))
 }
 
-// GetClients retrieves all clients
-func GetClients(w http.ResponseWriter, r *http.Request) {
-	clients, err := client.GetClients()
+// GetClients lists clients one page at a time, see parseListQuery for the query parameters
+func (h *Handler) GetClients(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r.URL.Query())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apperror.Write(w, err)
 		return
 	}
-	json.NewEncoder(w).Encode(clients)
+
+	page, err := h.Clients.ListClients(r.Context(), q)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(convertPage(page, newClientResponse))
 }
 
 // GetClientByID retrieves a client by its ObjectID
-func GetClientByID(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetClientByID(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	clientID, err := primitive.ObjectIDFromHex(params["id"])
+	clientID, err := parseObjectID(params["id"], "id")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apperror.Write(w, err)
+		return
+	}
+
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(clientID)) {
 		return
 	}
 
-	clientData, err := client.GetClientByID(clientID)
+	clientData, err := h.Clients.GetClientByID(r.Context(), clientID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apperror.Write(w, err)
 		return
 	}
-	json.NewEncoder(w).Encode(clientData)
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, clientData.Version)
+	json.NewEncoder(w).Encode(newClientResponse(*clientData))
 }
 
-// UpdateClient handles updating a client by ID, only the fields provided will be updated
-func UpdateClient(w http.ResponseWriter, r *http.Request) {
+// UpdateClient applies a JSON merge patch (RFC 7396) to a client and returns the updated client.
+// With If-Match it only applies to the version the caller read.
+func (h *Handler) UpdateClient(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	clientID, err := primitive.ObjectIDFromHex(params["id"])
+	clientID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(clientID)) {
+		return
+	}
+
+	existing, err := h.Clients.GetClientByID(r.Context(), clientID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apperror.Write(w, err)
+		return
+	}
+	if err := checkIfMatch(r, existing.Version); err != nil {
+		apperror.Write(w, err)
 		return
 	}
 
-	// Parse the update data from the request body as a dynamic map
-	var updatedData map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&updatedData); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	// Fields left out of the patch keep their current value
+	changes := existing.Patch()
+	if err := patch.Apply(&changes, r.Body); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	// The slug is the couple's subdomain, which the platform hands out
+	if changes.Slug != existing.Slug && !auth.FromContext(r.Context()).IsAdmin() {
+		apperror.Write(w, apperror.Forbidden("only an admin can change the slug").WithField("slug", "cannot be changed by the couple"))
 		return
 	}
 
-	// Update the client with only the fields provided in the request body
-	result, err := client.UpdateClient(clientID, updatedData)
+	// The write is based on the version read above, so a concurrent change is not overwritten
+	updated, err := h.Clients.UpdateClient(r.Context(), clientID, existing.Version, changes)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apperror.Write(w, versionConflict(r, err))
 		return
 	}
+	h.recordAudit(r, audit.NewEntry(r.Context(), audit.ActionUpdate, audit.ResourceClient, clientID, clientID, clientSnapshot(existing), clientSnapshot(updated)))
+	h.tenants.Forget(existing.Slug, updated.Slug)
+
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, updated.Version)
+	json.NewEncoder(w).Encode(newClientResponse(*updated))
+}
 
-	json.NewEncoder(w).Encode(result)
+// deleteClientResponse reports everything moved to the trash along with a client
+type deleteClientResponse struct {
+	DeletedClients int64 `json:"deleted_clients"`
+	DeletedGuests  int64 `json:"deleted_guests"`
 }
 
-// DeleteClient handles deleting a client by ID
-func DeleteClient(w http.ResponseWriter, r *http.Request) {
+// DeleteClient moves a client to the trash. A client that still has guests is only deleted
+// with cascade=true, which trashes the guests as well; everything happens in one transaction
+// when the database supports it. Events stay in place so restoring the client brings them back.
+func (h *Handler) DeleteClient(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	clientID, err := primitive.ObjectIDFromHex(params["id"])
+	clientID, err := parseObjectID(params["id"], "id")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apperror.Write(w, err)
 		return
 	}
-
-	result, err := client.DeleteClient(clientID)
+	cascade, err := parseBoolParam(r.URL.Query(), "cascade")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apperror.Write(w, err)
 		return
 	}
 
-	json.NewEncoder(w).Encode(result)
-}
+	at := revision.Now()
+	var report deleteClientResponse
+	var entries []audit.Entry
+	// The site stops being served from its slug and verified domains
+	var hosts []string
+	err = h.Tx.WithTransaction(r.Context(), func(ctx context.Context) error {
+		report = deleteClientResponse{}
+		entries = nil
+
+		existing, err := h.Clients.GetClientByID(ctx, clientID)
+		if err != nil {
+			return err
+		}
+		if err := checkIfMatch(r, existing.Version); err != nil {
+			return err
+		}
+		hosts = append([]string{existing.Slug}, existing.VerifiedHosts...)
+		entries = append(entries, audit.NewEntry(r.Context(), audit.ActionDelete, audit.ResourceClient, clientID, clientID, clientSnapshot(existing), nil))
 
-// Guest Handlers
+		guests, err := h.Guests.CountGuestsByClient(ctx, clientID)
+		if err != nil {
+			return err
+		}
+		if guests > 0 && !cascade {
+			return apperror.Conflict("client still has %d guests, delete with cascade=true to remove them too", guests)
+		}
 
-func CreateGuest(w http.ResponseWriter, r *http.Request) {
-	// Log the raw request body
-	bodyBytes, err := io.ReadAll(r.Body)
+		// The client goes first, so a concurrent change to it stops the delete before any guest
+		// is trashed
+		result, err := h.Clients.DeleteClient(ctx, clientID, existing.Version, at)
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount == 0 {
+			return client.ErrNotFound
+		}
+		report.DeletedClients = result.DeletedCount
+
+		if guests > 0 {
+			err := h.Guests.ForEachGuest(ctx, clientID, nil, func(g guest.Guest) error {
+				entries = append(entries, audit.NewEntry(r.Context(), audit.ActionDelete, audit.ResourceGuest, g.ID, clientID, guestSnapshot(&g), nil))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			deleted, err := h.Guests.DeleteGuestsByClient(ctx, clientID, at)
+			if err != nil {
+				return err
+			}
+			report.DeletedGuests = deleted.DeletedCount
+		}
+		return nil
+	})
 	if err != nil {
-		log.Printf("Error reading request body: %v", err)
-		http.Error(w, fmt.Sprintf("Error reading request body: %v", err), http.StatusBadRequest)
+		log.Printf("Error deleting client %s: %v", clientID.Hex(), err)
+		apperror.Write(w, versionConflict(r, err))
 		return
 	}
-	log.Printf("Raw request body: %s", string(bodyBytes))
+	h.recordAudit(r, entries...)
+	h.tenants.Forget(hosts...)
 
-	// Restore the request body for further processing
-	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// Guest Handlers
 
-	var newGuest guest.Guest
-	if err := json.NewDecoder(r.Body).Decode(&newGuest); err != nil {
+// CreateGuest records an RSVP from the public form and returns the new guest with a token
+// letting them edit it later
+func (h *Handler) CreateGuest(w http.ResponseWriter, r *http.Request) {
+	// limitRSVP caps the body size
+	var req createGuestRequest
+	if err := decodeJSON(r, &req); err != nil {
 		log.Printf("Error decoding request body: %v", err)
-		http.Error(w, fmt.Sprintf("Invalid request payload: %v", err), http.StatusBadRequest)
+		apperror.Write(w, err)
 		return
 	}
-
-	// Extract client_id from the request body
-	var requestBody map[string]interface{}
-	r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes)) // Reset the body for second read
-	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		log.Printf("Error decoding request body: %v", err)
-		http.Error(w, fmt.Sprintf("Invalid request payload: %v", err), http.StatusBadRequest)
+	newGuest := req.guest()
+
+	// Bots fill in the hidden honeypot field; pretend the RSVP went through so they move on
+	if req.Website != "" {
+		log.Printf("Dropped RSVP with the %s honeypot field set from %s", honeypotField, clientIP(r))
+		newGuest.ID = primitive.NewObjectID()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(createGuestResponse{guestResponse: newGuestResponse(newGuest)})
 		return
 	}
 
-	clientIDStr, ok := requestBody["client_id"].(string)
-	if !ok {
-		log.Printf("client_id is missing or not a string")
-		http.Error(w, "client_id must be a valid string", http.StatusBadRequest)
+	// RSVPs sent from a personalized link attach to the pre-registered invitee
+	if req.InvitationToken != "" {
+		h.respondToInvitation(w, r, req.InvitationToken, newGuest)
 		return
 	}
 
-	// Convert client_id from string to ObjectID
-	clientID, err := primitive.ObjectIDFromHex(clientIDStr)
-	if err != nil {
-		log.Printf("Error converting client_id to ObjectID: %v", err)
-		http.Error(w, fmt.Sprintf("Invalid client_id: %v", err), http.StatusBadRequest)
+	// RSVPs sent from a couple's site are for that couple unless they name a client
+	clientID, fromSite := tenant.FromContext(r.Context())
+	if req.ClientID != "" {
+		var err error
+		clientID, err = parseObjectID(req.ClientID, "client_id")
+		if err != nil {
+			log.Printf("Error converting client_id to ObjectID: %v", err)
+			apperror.Write(w, err)
+			return
+		}
+	} else if !fromSite {
+		apperror.Write(w, apperror.InvalidField("client_id", "is required unless the RSVP is sent from the couple's site"))
 		return
 	}
 
 	newGuest.ClientID = clientID
+	newGuest.ModerateMessage(guest.Guest{}, config.MessageBlocklist)
+
+	if err := h.allowClientRSVP(r, clientID); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	release, err := h.claimRSVP(clientID, newGuest.Name, newGuest.Message)
+	if err != nil {
+		log.Printf("Rejected duplicate RSVP for client %s", clientID.Hex())
+		apperror.Write(w, err)
+		return
+	}
 
 	// Insert the new guest into the database
-	result, err := guest.CreateGuest(newGuest)
+	result, err := h.Guests.CreateGuest(r.Context(), newGuest)
 	if err != nil {
+		release()
 		log.Printf("Error creating guest: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to create guest: %v", err), http.StatusInternalServerError)
+		apperror.Write(w, err)
+		return
+	}
+
+	guestID, _ := result.InsertedID.(primitive.ObjectID)
+	created, err := h.Guests.GetGuestByID(r.Context(), guestID)
+	if err != nil {
+		log.Printf("Error reading created guest %s: %v", guestID.Hex(), err)
+		apperror.Write(w, err)
+		return
+	}
+	h.recordAudit(r, audit.NewEntry(r.Context(), audit.ActionCreate, audit.ResourceGuest, guestID, clientID, nil, guestSnapshot(created)))
+
+	// Hand the guest a token so they can come back and edit their own RSVP
+	token, err := h.issueGuestToken(guestID, clientID)
+	if err != nil {
+		log.Printf("Error issuing guest token: %v", err)
+		apperror.Write(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	setETag(w, created.Version)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createGuestResponse{guestResponse: newGuestResponse(*created), GuestToken: token})
 }
 
-func GetGuestsByClient(w http.ResponseWriter, r *http.Request) {
+// GetGuestsByClient lists a client's guests one page at a time. Besides the parameters read
+// by parseListQuery it takes client_id (required) and status (comma-separated statuses).
+func (h *Handler) GetGuestsByClient(w http.ResponseWriter, r *http.Request) {
 	// Fetch clientID from the URL query parameters
 	clientIDHex := r.URL.Query().Get("client_id")
 	if clientIDHex == "" {
-		http.Error(w, "client_id is required", http.StatusBadRequest)
+		apperror.Write(w, apperror.InvalidField("client_id", "is required"))
 		return
 	}
 
 	// Convert the client_id from string to MongoDB ObjectID
-	clientID, err := primitive.ObjectIDFromHex(clientIDHex)
+	clientID, err := parseObjectID(clientIDHex, "client_id")
 	if err != nil {
 		log.Printf("Invalid client_id format: %v", err)
-		http.Error(w, "Invalid client_id format", http.StatusBadRequest)
+		apperror.Write(w, err)
+		return
+	}
+
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(clientID)) {
 		return
 	}
 
-	// Fetch guests associated with the given clientID
-	guests, err := guest.GetGuestsByClient(clientID)
+	q, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	statuses, err := parseStatusFilter(r.URL.Query().Get("status"))
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	// Fetch one page of the guests associated with the given clientID
+	page, err := h.Guests.ListGuests(r.Context(), clientID, statuses, q)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.Printf("No guests found for client ID: %s", clientIDHex)
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode([]guest.Guest{}) // Return an empty array instead of error
-			return
-		}
 		log.Printf("Error fetching guests: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apperror.Write(w, err)
 		return
 	}
 
-	// Return the guests found
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(guests)
+	json.NewEncoder(w).Encode(convertPage(page, newGuestResponse))
 }
 
-func GetGuestByID(w http.ResponseWriter, r *http.Request) {
+// GetGuestByID retrieves a guest; guests may read their own RSVP
+func (h *Handler) GetGuestByID(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	guestID, err := primitive.ObjectIDFromHex(params["id"])
+	guestID, err := parseObjectID(params["id"], "id")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apperror.Write(w, err)
+		return
+	}
+
+	// Another client's guest answers like a missing one, so IDs cannot be probed
+	principal := auth.FromContext(r.Context())
+	if !auth.Authorize(w, r, principal.IsAuthenticated()) {
+		return
+	}
+	if principal.Role == auth.RoleGuest && principal.GuestID != guestID {
+		apperror.Write(w, guest.ErrNotFound)
 		return
 	}
 
-	guestData, err := guest.GetGuestByID(guestID)
+	guestData, err := h.Guests.GetGuestByID(r.Context(), guestID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apperror.Write(w, err)
 		return
 	}
-	json.NewEncoder(w).Encode(guestData)
+	if !principal.CanAccessGuest(guestData.ID, guestData.ClientID) {
+		apperror.Write(w, guest.ErrNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, guestData.Version)
+	json.NewEncoder(w).Encode(newGuestResponse(*guestData))
 }
 
-func UpdateGuest(w http.ResponseWriter, r *http.Request) {
+// UpdateGuest applies a JSON merge patch (RFC 7396) to a guest and returns the updated guest.
+// Guests may change their own RSVP; the invitee details are reserved for the couple. With
+// If-Match it only applies to the version the caller read.
+func (h *Handler) UpdateGuest(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	guestID, err := primitive.ObjectIDFromHex(params["id"])
+	guestID, err := parseObjectID(params["id"], "id")
 	if err != nil {
 		log.Printf("Invalid guest ID: %v", err)
-		http.Error(w, "Invalid guest ID", http.StatusBadRequest)
+		apperror.Write(w, err)
 		return
 	}
 
-	var updatedGuest guest.Guest
-	if err := json.NewDecoder(r.Body).Decode(&updatedGuest); err != nil {
-		log.Printf("Error decoding request body: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	}
-
-	// Fetch the existing guest to get the current ClientID if not provided in the request
-	existingGuest, err := guest.GetGuestByID(guestID)
+	existingGuest, err := h.Guests.GetGuestByID(r.Context(), guestID)
 	if err != nil {
 		log.Printf("Error fetching existing guest: %v", err)
-		http.Error(w, "Failed to fetch existing guest", http.StatusInternalServerError)
+		apperror.Write(w, err)
 		return
 	}
 
-	// If the ClientID is not provided, use the existing ClientID
-	if updatedGuest.ClientID.IsZero() {
-		updatedGuest.ClientID = existingGuest.ClientID
+	principal := auth.FromContext(r.Context())
+	if !auth.Authorize(w, r, principal.CanAccessGuest(existingGuest.ID, existingGuest.ClientID)) {
+		return
+	}
+	if err := checkIfMatch(r, existingGuest.Version); err != nil {
+		apperror.Write(w, err)
+		return
 	}
 
-	// Validate that the ClientID is not zero
-	if updatedGuest.ClientID.IsZero() {
-		log.Printf("Invalid client_id: client_id is zero")
-		http.Error(w, "Invalid client_id: client_id cannot be zero", http.StatusBadRequest)
+	// Fields left out of the patch keep their current value
+	current := existingGuest.Patch()
+	changes := current
+	if err := patch.Apply(&changes, r.Body); err != nil {
+		apperror.Write(w, err)
 		return
 	}
 
-	// Update the guest with the new or existing data
-	result, err := guest.UpdateGuest(guestID, updatedGuest)
+	// Only the couple may change the invitee details, such as how many people they can bring
+	if !principal.CanManageClient(existingGuest.ClientID) {
+		denied := apperror.Forbidden("only the couple can change the invitee details")
+		for field, changed := range map[string]bool{
+			"max_party_size": changes.MaxPartySize != current.MaxPartySize,
+			"phone":          changes.Phone != current.Phone,
+			"group":          changes.Group != current.Group,
+		} {
+			if changed {
+				denied = denied.WithField(field, "cannot be changed by the guest")
+			}
+		}
+		if len(denied.Fields) > 0 {
+			apperror.Write(w, denied)
+			return
+		}
+	}
+
+	next := changes.Apply(*existingGuest)
+	next.ModerateMessage(*existingGuest, config.MessageBlocklist)
+	updated, err := h.Guests.UpdateGuest(r.Context(), guestID, next)
 	if err != nil {
 		log.Printf("Error updating guest: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apperror.Write(w, versionConflict(r, err))
 		return
 	}
+	h.recordAudit(r, audit.NewEntry(r.Context(), audit.ActionUpdate, audit.ResourceGuest, guestID, existingGuest.ClientID, guestSnapshot(existingGuest), guestSnapshot(updated)))
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	setETag(w, updated.Version)
+	json.NewEncoder(w).Encode(newGuestResponse(*updated))
 }
 
-func DeleteGuest(w http.ResponseWriter, r *http.Request) {
+// DeleteGuest moves a guest to the trash, from where an admin can restore it
+func (h *Handler) DeleteGuest(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	guestID, err := primitive.ObjectIDFromHex(params["id"])
+	guestID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	existingGuest, err := h.Guests.GetGuestByID(r.Context(), guestID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apperror.Write(w, err)
+		return
+	}
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(existingGuest.ClientID)) {
+		return
+	}
+	if err := checkIfMatch(r, existingGuest.Version); err != nil {
+		apperror.Write(w, err)
 		return
 	}
 
-	result, err := guest.DeleteGuest(guestID)
+	// The write is based on the version read above, so a concurrent change is not lost
+	result, err := h.Guests.DeleteGuest(r.Context(), guestID, existingGuest.Version)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apperror.Write(w, versionConflict(r, err))
 		return
 	}
+	if result.DeletedCount > 0 {
+		// A trashed guest does not attend; restoring it takes the seats back
+		h.giveBackSeats(r.Context(), existingGuest.EventRSVPs)
+		h.recordAudit(r, audit.NewEntry(r.Context(), audit.ActionDelete, audit.ResourceGuest, guestID, existingGuest.ClientID, guestSnapshot(existingGuest), nil))
+	}
 
-	json.NewEncoder(w).Encode(result)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deleteGuestResponse{DeletedGuests: result.DeletedCount})
 }
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/audit"
+	"deili-backend/internal/auth"
+	"deili-backend/internal/guest"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// maxImportBytes bounds the uploaded CSV; a few thousand invitees fit comfortably
+	maxImportBytes = 5 << 20
+	// importBatchSize is how many guests go into one InsertMany
+	importBatchSize = 500
+	// documentValidationFailure is the server error code for a document the validator refused
+	documentValidationFailure = 121
+)
+
+// Per-row outcomes of a guest import
+const (
+	importCreated = "created"
+	importSkipped = "skipped"
+	importFailed  = "failed"
+)
+
+// importRowResult reports what happened to one row of the import file
+type importRowResult struct {
+	Line    int                 `json:"line"`
+	Name    string              `json:"name,omitempty"`
+	Status  string              `json:"status"`
+	GuestID *primitive.ObjectID `json:"guest_id,omitempty"`
+	Reason  string              `json:"reason,omitempty"`
+}
+
+// importReport summarizes a guest import; in a dry run nothing is written and "created"
+// means the row would be created
+type importReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Skipped int               `json:"skipped"`
+	Failed  int               `json:"failed"`
+	Rows    []importRowResult `json:"rows"`
+}
+
+// ImportGuests pre-registers invitees from a CSV with the columns name, phone, group and
+// max_party_size. The file is sent either as the raw request body or as the "file" field of a
+// multipart form. Rows matching an existing guest (by phone, or by name when there is no phone)
+// are skipped. Pass dry_run=true to validate without writing anything.
+func (h *Handler) ImportGuests(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	clientID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(clientID)) {
+		return
+	}
+
+	dryRun, err := parseBoolParam(r.URL.Query(), "dry_run")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	if _, err := h.Clients.GetClientByID(r.Context(), clientID); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	file, err := importFile(r)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	defer file.Close()
+
+	rows, err := guest.ReadImportCSV(file, clientID)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apperror.Write(w, apperror.New(apperror.CodePayloadTooLarge, "import file exceeds %d bytes", maxImportBytes))
+			return
+		}
+		apperror.Write(w, apperror.InvalidField("file", "invalid import file: %v", err))
+		return
+	}
+
+	// Collect the keys of guests the client already has
+	seen := map[string]string{}
+	err = h.Guests.ForEachGuest(r.Context(), clientID, nil, func(g guest.Guest) error {
+		seen[guest.DedupKey(g)] = "matches existing guest " + g.ID.Hex()
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error loading existing guests for import: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+
+	report := importReport{DryRun: dryRun, Total: len(rows), Rows: make([]importRowResult, len(rows))}
+	var pending []guest.Guest
+	var pendingRows []int
+	for i, row := range rows {
+		result := importRowResult{Line: row.Line, Name: row.Guest.Name}
+		if row.Err != nil {
+			result.Status, result.Reason = importFailed, row.Err.Error()
+			report.Rows[i] = result
+			continue
+		}
+
+		key := guest.DedupKey(row.Guest)
+		if reason, ok := seen[key]; ok {
+			result.Status, result.Reason = importSkipped, reason
+			report.Rows[i] = result
+			continue
+		}
+		seen[key] = fmt.Sprintf("duplicate of line %d", row.Line)
+
+		token, err := guest.NewInvitationToken()
+		if err != nil {
+			log.Printf("Error generating invitation token: %v", err)
+			apperror.Write(w, err)
+			return
+		}
+		invitee := row.Guest
+		invitee.ID = primitive.NewObjectID()
+		invitee.InvitationToken = token
+
+		result.Status = importCreated
+		if !dryRun {
+			id := invitee.ID
+			result.GuestID = &id
+		}
+		report.Rows[i] = result
+		pending = append(pending, invitee)
+		pendingRows = append(pendingRows, i)
+	}
+
+	if !dryRun {
+		for start := 0; start < len(pending); start += importBatchSize {
+			end := min(start+importBatchSize, len(pending))
+			_, err := h.Guests.CreateGuests(r.Context(), clientID, pending[start:end])
+			if err != nil {
+				log.Printf("Error inserting import batch for client %s: %v", clientID.Hex(), err)
+				markImportBatchFailed(report.Rows, pendingRows[start:end], err)
+			}
+		}
+
+		// The audit log records the guests as stored, after the store normalized them
+		created := map[primitive.ObjectID]bool{}
+		for k, i := range pendingRows {
+			if report.Rows[i].Status == importCreated {
+				created[pending[k].ID] = true
+			}
+		}
+		var entries []audit.Entry
+		err := h.Guests.ForEachGuest(r.Context(), clientID, nil, func(g guest.Guest) error {
+			if created[g.ID] {
+				entries = append(entries, audit.NewEntry(r.Context(), audit.ActionCreate, audit.ResourceGuest, g.ID, clientID, nil, guestSnapshot(&g)))
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Error loading imported guests of client %s for the audit log: %v", clientID.Hex(), err)
+		}
+		h.recordAudit(r, entries...)
+	}
+
+	for _, row := range report.Rows {
+		switch row.Status {
+		case importCreated:
+			report.Created++
+		case importSkipped:
+			report.Skipped++
+		case importFailed:
+			report.Failed++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// markImportBatchFailed flags the rows of a batch that did not get inserted. An unordered
+// InsertMany reports exactly which documents failed; any other error fails the whole batch.
+func markImportBatchFailed(rows []importRowResult, batchRows []int, err error) {
+	fail := func(i int, reason string) {
+		rows[i].Status = importFailed
+		rows[i].GuestID = nil
+		rows[i].Reason = reason
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil && len(bulkErr.WriteErrors) > 0 {
+		for _, writeErr := range bulkErr.WriteErrors {
+			if writeErr.Index >= 0 && writeErr.Index < len(batchRows) {
+				fail(batchRows[writeErr.Index], importFailureReason(writeErr))
+			}
+		}
+		return
+	}
+	for _, i := range batchRows {
+		fail(i, importFailureReason(err))
+	}
+}
+
+// importFailureReason tells why a row was not stored without passing on the driver's details,
+// which the caller already logged
+func importFailureReason(err error) string {
+	var serverErr mongo.ServerError
+	switch {
+	case mongo.IsDuplicateKeyError(err):
+		return "duplicates a stored guest"
+	case errors.As(err, &serverErr) && serverErr.HasErrorCode(documentValidationFailure):
+		return "does not pass the database validation"
+	}
+	if appErr := apperror.From(err); appErr.Code != apperror.CodeInternal {
+		return appErr.Message
+	}
+	return "could not be stored, try again"
+}
+
+// importFile returns the uploaded CSV from a multipart "file" field or the raw body
+func importFile(r *http.Request) (io.ReadCloser, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		return r.Body, nil
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return nil, apperror.InvalidField("file", "multipart upload must include a \"file\" field: %v", err)
+	}
+	return file, nil
+}
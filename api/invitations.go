@@ -0,0 +1,252 @@
+package api
+
+import (
+	"deili-backend/config"
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/audit"
+	"deili-backend/internal/auth"
+	"deili-backend/internal/guest"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// inviteeResponse is a pre-registered guest together with their personalized link
+type inviteeResponse struct {
+	ID              primitive.ObjectID       `json:"id"`
+	Name            string                   `json:"name"`
+	Confirmation    guest.ConfirmationStatus `json:"confirmation"`
+	PartySize       int                      `json:"party_size"`
+	MaxPartySize    int                      `json:"max_party_size"`
+	InvitationToken string                   `json:"invitation_token"`
+	InvitationLink  string                   `json:"invitation_link"`
+}
+
+// invitationResponse is what the public invitation page needs to greet an invitee by name
+type invitationResponse struct {
+	GuestName    string                   `json:"guest_name"`
+	ClientID     primitive.ObjectID       `json:"client_id"`
+	ClientName   string                   `json:"client_name"`
+	Theme        string                   `json:"theme"`
+	Confirmation guest.ConfirmationStatus `json:"confirmation"`
+	PartySize    int                      `json:"party_size"`
+	PlusOnes     []string                 `json:"plus_ones"`
+	MaxPartySize int                      `json:"max_party_size"`
+	Message      string                   `json:"message"`
+	Events       []invitationEvent        `json:"events"`
+}
+
+// invitationEvent is an event the invitee is invited to, with their answer if they gave one
+type invitationEvent struct {
+	eventResponse
+	RSVP *guest.EventRSVP `json:"rsvp,omitempty"`
+}
+
+func newInviteeResponse(g guest.Guest) inviteeResponse {
+	return inviteeResponse{
+		ID:              g.ID,
+		Name:            g.Name,
+		Confirmation:    g.Confirmation,
+		PartySize:       g.PartySize,
+		MaxPartySize:    g.EffectiveMaxPartySize(),
+		InvitationToken: g.InvitationToken,
+		InvitationLink:  guest.InvitationLink(config.InvitationBaseURL, g.InvitationToken),
+	}
+}
+
+// CreateInvitee pre-registers a guest for a client and returns their personalized link
+func (h *Handler) CreateInvitee(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	clientID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(clientID)) {
+		return
+	}
+
+	var body struct {
+		Name         string               `json:"name"`
+		MaxPartySize int                  `json:"max_party_size"`
+		EventIDs     []primitive.ObjectID `json:"event_ids"`
+	}
+	if err := decodeJSON(r, &body); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		apperror.Write(w, apperror.InvalidField("name", "cannot be empty"))
+		return
+	}
+
+	if err := h.validateEventIDs(r.Context(), clientID, body.EventIDs); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	token, err := guest.NewInvitationToken()
+	if err != nil {
+		log.Printf("Error generating invitation token: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+
+	invitee := guest.Guest{
+		Name:            body.Name,
+		ClientID:        clientID,
+		InvitationToken: token,
+		MaxPartySize:    body.MaxPartySize,
+		InvitedEventIDs: body.EventIDs,
+	}
+	result, err := h.Guests.CreateGuest(r.Context(), invitee)
+	if err != nil {
+		log.Printf("Error creating invitee: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+	inviteeID, _ := result.InsertedID.(primitive.ObjectID)
+	created, err := h.Guests.GetGuestByID(r.Context(), inviteeID)
+	if err != nil {
+		log.Printf("Error reading created invitee %s: %v", inviteeID.Hex(), err)
+		apperror.Write(w, err)
+		return
+	}
+	h.recordAudit(r, audit.NewEntry(r.Context(), audit.ActionCreate, audit.ResourceGuest, inviteeID, clientID, nil, guestSnapshot(created)))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newInviteeResponse(*created))
+}
+
+// GetInvitees lists the pre-registered guests of a client with their personalized links
+func (h *Handler) GetInvitees(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	clientID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(clientID)) {
+		return
+	}
+
+	guests, err := h.Guests.GetGuestsByClient(r.Context(), clientID)
+	if err != nil {
+		log.Printf("Error fetching invitees: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+
+	invitees := []inviteeResponse{}
+	for _, g := range guests {
+		if g.InvitationToken != "" {
+			invitees = append(invitees, newInviteeResponse(g))
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invitees)
+}
+
+// GetInvitation resolves a personalized link token to the invitee's name and the client's theme
+func (h *Handler) GetInvitation(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	invitee, err := h.Guests.GetGuestByInvitationToken(r.Context(), token)
+	if err != nil {
+		log.Printf("Error resolving invitation token: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+
+	clientData, err := h.Clients.GetClientByID(r.Context(), invitee.ClientID)
+	if err != nil {
+		log.Printf("Error fetching client for invitation: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+
+	events, err := h.Events.GetEventsByClient(r.Context(), invitee.ClientID)
+	if err != nil {
+		log.Printf("Error fetching events for invitation: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+	invitedEvents := []invitationEvent{}
+	for _, e := range events {
+		if !invitee.IsInvitedTo(e.ID) {
+			continue
+		}
+		item := invitationEvent{eventResponse: newEventResponse(e)}
+		if rsvp, ok := invitee.EventRSVP(e.ID); ok {
+			item.RSVP = &rsvp
+		}
+		invitedEvents = append(invitedEvents, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(invitationResponse{
+		GuestName:    invitee.Name,
+		ClientID:     clientData.ID,
+		ClientName:   clientData.Name,
+		Theme:        clientData.InvitationTypes,
+		Confirmation: invitee.Confirmation,
+		PartySize:    invitee.PartySize,
+		PlusOnes:     invitee.PlusOnes,
+		MaxPartySize: invitee.EffectiveMaxPartySize(),
+		Message:      invitee.Message,
+		Events:       invitedEvents,
+	})
+}
+
+// respondToInvitation records an RSVP on the pre-registered invitee owning token instead of
+// inserting a new anonymous guest
+func (h *Handler) respondToInvitation(w http.ResponseWriter, r *http.Request, token string, rsvp guest.Guest) {
+	invitee, err := h.Guests.GetGuestByInvitationToken(r.Context(), token)
+	if err != nil {
+		log.Printf("Error resolving invitation token: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+
+	// The couple chose the invitee's name; the RSVP only carries their answer and wishes
+	updated := *invitee
+	updated.Message = rsvp.Message
+	updated.Confirmation = rsvp.Confirmation
+	updated.PartySize = rsvp.PartySize
+	updated.PlusOnes = rsvp.PlusOnes
+	updated.ModerateMessage(*invitee, config.MessageBlocklist)
+
+	// A token lets its holder rewrite the invitee's message, so the per-client limit applies as
+	// to new RSVPs. Duplicate detection does not: a token only ever rewrites its own invitee,
+	// and sending the same message again is how an invitee corrects their answer.
+	if err := h.allowClientRSVP(r, invitee.ClientID); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	answered, err := h.Guests.UpdateGuest(r.Context(), invitee.ID, updated)
+	if err != nil {
+		log.Printf("Error recording invitation RSVP: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+	h.recordAudit(r, audit.NewEntry(r.Context(), audit.ActionUpdate, audit.ResourceGuest, invitee.ID, invitee.ClientID, guestSnapshot(invitee), guestSnapshot(answered)))
+
+	guestToken, err := h.issueGuestToken(invitee.ID, invitee.ClientID)
+	if err != nil {
+		log.Printf("Error issuing guest token: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, answered.Version)
+	json.NewEncoder(w).Encode(createGuestResponse{guestResponse: newGuestResponse(*answered), GuestToken: guestToken})
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/guest"
+	"deili-backend/internal/listing"
+	"net/url"
+	"strconv"
+)
+
+// parseListQuery reads the pagination parameters shared by the list endpoints: limit,
+// page_token (from the previous page's next_page_token), sort (created_at or name), order
+// (asc or desc, default asc) and q (case-insensitive name search)
+func parseListQuery(values url.Values) (listing.Query, error) {
+	q := listing.Query{
+		SortBy:    listing.SortField(values.Get("sort")),
+		Search:    values.Get("q"),
+		PageToken: values.Get("page_token"),
+	}
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return q, listing.InvalidParam("limit", "limit must be a positive integer")
+		}
+		q.Limit = n
+	}
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Descending = true
+	default:
+		return q, listing.InvalidParam("order", "order must be asc or desc")
+	}
+	return q, q.Normalize()
+}
+
+// parseBoolParam reads an optional true/false query parameter, defaulting to false
+func parseBoolParam(values url.Values, name string) (bool, error) {
+	value := values.Get(name)
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, apperror.InvalidField(name, "must be true or false")
+	}
+	return b, nil
+}
+
+// parseStatusFilter reads a comma-separated list of confirmation statuses
+func parseStatusFilter(value string) ([]guest.ConfirmationStatus, error) {
+	var statuses []guest.ConfirmationStatus
+	for _, item := range splitList(value) {
+		status, err := guest.ParseConfirmationStatus(item)
+		if err != nil {
+			return nil, listing.InvalidParam("status", "unknown status %q", item)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/audit"
+	"deili-backend/internal/auth"
+	"deili-backend/internal/guest"
+	"deili-backend/internal/listing"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// publicMessage is a guest's message as shown on the invitation page's message wall
+type publicMessage struct {
+	ID       primitive.ObjectID `json:"id"`
+	Name     string             `json:"name"`
+	Message  string             `json:"message"`
+	PostedAt time.Time          `json:"posted_at"`
+}
+
+// moderationItem is a message as the couple sees it while moderating
+type moderationItem struct {
+	publicMessage
+	Status     guest.MessageStatus `json:"status"`
+	HoldReason string              `json:"hold_reason,omitempty"`
+}
+
+func newPublicMessage(g guest.Guest) publicMessage {
+	posted := g.RespondedAt
+	if posted.IsZero() {
+		posted = g.ID.Timestamp()
+	}
+	return publicMessage{ID: g.ID, Name: g.Name, Message: g.Message, PostedAt: posted}
+}
+
+func newModerationItem(g guest.Guest) moderationItem {
+	status := g.MessageStatus
+	if status == "" {
+		status = guest.MessagePending
+	}
+	return moderationItem{publicMessage: newPublicMessage(g), Status: status, HoldReason: g.MessageHoldReason}
+}
+
+// convertPage maps the items of a page, keeping its total and page token
+func convertPage[T, U any](page *listing.Page[T], convert func(T) U) listing.Page[U] {
+	items := make([]U, len(page.Items))
+	for i, item := range page.Items {
+		items[i] = convert(item)
+	}
+	return listing.Page[U]{Items: items, Total: page.Total, NextPageToken: page.NextPageToken}
+}
+
+// GetMessages lists a client's approved guest messages for the public message wall, see
+// parseListQuery for the query parameters
+func (h *Handler) GetMessages(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	clientID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	q, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	if _, err := h.Clients.GetClientByID(r.Context(), clientID); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	page, err := h.Guests.ListMessages(r.Context(), clientID, []guest.MessageStatus{guest.MessageApproved}, q)
+	if err != nil {
+		log.Printf("Error fetching messages: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(convertPage(page, newPublicMessage))
+}
+
+// GetMessageQueue lists a client's messages for moderation. status takes comma-separated
+// message statuses and defaults to pending.
+func (h *Handler) GetMessageQueue(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	clientID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(clientID)) {
+		return
+	}
+
+	q, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	statuses := []guest.MessageStatus{guest.MessagePending}
+	if value := r.URL.Query().Get("status"); value != "" {
+		statuses = nil
+		for _, item := range splitList(value) {
+			status := guest.MessageStatus(item)
+			if !status.Valid() {
+				apperror.Write(w, listing.InvalidParam("status", "unknown message status %q", item))
+				return
+			}
+			statuses = append(statuses, status)
+		}
+	}
+
+	page, err := h.Guests.ListMessages(r.Context(), clientID, statuses, q)
+	if err != nil {
+		log.Printf("Error fetching message queue: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(convertPage(page, newModerationItem))
+}
+
+// ModerateMessage lets the couple approve or hide a guest's message
+func (h *Handler) ModerateMessage(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	guestID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	existingGuest, err := h.Guests.GetGuestByID(r.Context(), guestID)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(existingGuest.ClientID)) {
+		return
+	}
+	if err := checkIfMatch(r, existingGuest.Version); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	var body struct {
+		Status guest.MessageStatus `json:"status"`
+	}
+	if err := decodeJSON(r, &body); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if body.Status != guest.MessageApproved && body.Status != guest.MessageHidden {
+		apperror.Write(w, apperror.InvalidField("status", "must be %q or %q", guest.MessageApproved, guest.MessageHidden))
+		return
+	}
+	if existingGuest.Message == "" {
+		apperror.Write(w, apperror.Conflict("guest %s has not left a message", guestID.Hex()))
+		return
+	}
+
+	updated, err := h.Guests.SetMessageStatus(r.Context(), guestID, existingGuest.Version, body.Status)
+	if err != nil {
+		log.Printf("Error moderating message: %v", err)
+		apperror.Write(w, versionConflict(r, err))
+		return
+	}
+	h.recordAudit(r, audit.NewEntry(r.Context(), audit.ActionUpdate, audit.ResourceGuest, guestID, existingGuest.ClientID, guestSnapshot(existingGuest), guestSnapshot(updated)))
+
+	w.Header().Set("Content-Type", "application/json")
+	setETag(w, updated.Version)
+	json.NewEncoder(w).Encode(newModerationItem(*updated))
+}
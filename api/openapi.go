@@ -0,0 +1,18 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec describes every route registered by routes. It is maintained by hand;
+// TestOpenAPICoversRoutes fails when a route is missing from it.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// GetOpenAPISpec serves the OpenAPI 3 document of the API
+func (h *Handler) GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
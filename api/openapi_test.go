@@ -0,0 +1,176 @@
+package api
+
+import (
+	"deili-backend/database"
+	"deili-backend/internal/audit"
+	"deili-backend/internal/auth"
+	"deili-backend/internal/client"
+	"deili-backend/internal/event"
+	"deili-backend/internal/guest"
+	"deili-backend/internal/idempotency"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// openAPIDoc is the part of the OpenAPI document the tests look at
+type openAPIDoc struct {
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+// operation is the part of an operation the tests look at
+type operation struct {
+	Responses map[string]json.RawMessage `json:"responses"`
+}
+
+func loadSpec(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	return doc
+}
+
+// versionedRoutes returns "METHOD /path" for every route registered under APIPrefix, with
+// paths relative to the prefix as they appear in the spec
+func versionedRoutes(t *testing.T) map[string]bool {
+	t.Helper()
+	cs := client.NewMemoryStore()
+	h := NewHandler(cs, guest.NewMemoryStore(cs), event.NewMemoryStore(), audit.NewMemoryStore(), idempotency.NewMemoryStore(),
+		database.NoTransactions{}, auth.NewAuthenticator(strings.Repeat("s", 32), ""))
+	r := mux.NewRouter()
+	RegisterRoutes(r, h)
+
+	routes := map[string]bool{}
+	err := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || !strings.HasPrefix(path, APIPrefix+"/") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			t.Errorf("route %s does not restrict its methods", path)
+			return nil
+		}
+		for _, method := range methods {
+			routes[method+" "+strings.TrimPrefix(path, APIPrefix)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) == 0 {
+		t.Fatal("no routes registered under " + APIPrefix)
+	}
+	return routes
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TestOpenAPICoversRoutes fails when a route is added without a spec entry, or a spec entry
+// outlives its route
+func TestOpenAPICoversRoutes(t *testing.T) {
+	doc := loadSpec(t)
+	routes := versionedRoutes(t)
+
+	for _, route := range sortedKeys(routes) {
+		method, path, _ := strings.Cut(route, " ")
+		if _, ok := doc.Paths[path][strings.ToLower(method)]; !ok {
+			t.Errorf("%s %s is not described in openapi.json", method, path)
+		}
+	}
+
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			if !routes[strings.ToUpper(method)+" "+path] {
+				t.Errorf("openapi.json describes %s %s, which has no route", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+// TestOpenAPIResponses checks that every operation documents its success and its errors
+func TestOpenAPIResponses(t *testing.T) {
+	doc := loadSpec(t)
+	for path, item := range doc.Paths {
+		for method, raw := range item {
+			if method == "parameters" {
+				continue
+			}
+			var op operation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				t.Errorf("%s %s: %v", method, path, err)
+				continue
+			}
+			var success, failure bool
+			for status := range op.Responses {
+				success = success || strings.HasPrefix(status, "2")
+				failure = failure || strings.HasPrefix(status, "4") || strings.HasPrefix(status, "5")
+			}
+			if !success || !failure {
+				t.Errorf("%s %s must document a success and an error response", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+// TestOpenAPIRefs checks that every $ref points at a component defined in the document
+func TestOpenAPIRefs(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatal(err)
+	}
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				if !resolves(doc, ref) {
+					t.Errorf("unresolved $ref %s", ref)
+				}
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+}
+
+// resolves reports whether ref, a local JSON pointer such as #/components/schemas/Guest, exists in doc
+func resolves(doc any, ref string) bool {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return false
+	}
+	node := doc
+	for _, part := range strings.Split(pointer, "/") {
+		m, ok := node.(map[string]any)
+		if !ok {
+			return false
+		}
+		if node, ok = m[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
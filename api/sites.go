@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/client"
+	"deili-backend/internal/tenant"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// lookupSite finds the client whose slug is a site's subdomain, for the tenant resolver.
+// Labels that cannot be slugs, such as www, are not looked up.
+func (h *Handler) lookupSite(ctx context.Context, slug string) (primitive.ObjectID, error) {
+	if normalized, err := client.NormalizeSlug(slug); err != nil || normalized != slug {
+		return primitive.NilObjectID, client.ErrNotFound
+	}
+	c, err := h.Clients.GetClientBySlug(ctx, slug)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return c.ID, nil
+}
+
+// GetSite returns the public view of the client whose site the request comes from, so a page
+// served on a couple's subdomain learns which client it belongs to
+func (h *Handler) GetSite(w http.ResponseWriter, r *http.Request) {
+	clientID, ok := tenant.FromContext(r.Context())
+	if !ok {
+		apperror.Write(w, apperror.New(apperror.CodeNotFound, "the request does not come from a couple's site"))
+		return
+	}
+	c, err := h.Clients.GetClientByID(r.Context(), clientID)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newSiteResponse(*c))
+}
+
+// GetSiteBySlug returns the public view of the client with the slug
+func (h *Handler) GetSiteBySlug(w http.ResponseWriter, r *http.Request) {
+	slug, err := client.NormalizeSlug(mux.Vars(r)["slug"])
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	c, err := h.Clients.GetClientBySlug(r.Context(), slug)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newSiteResponse(*c))
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"crypto/sha256"
+	"deili-backend/config"
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/auth"
+	"deili-backend/internal/ratelimit"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// honeypotField is an RSVP form field the invitation page hides from people, so only bots
+// fill it in
+const honeypotField = "website"
+
+// rsvpGuard holds the spam protection state of the public RSVP endpoint
+type rsvpGuard struct {
+	perIP     *ratelimit.Limiter
+	perClient *ratelimit.Limiter
+	// recent remembers recent submissions; nil when duplicate detection is off
+	recent *ratelimit.Recent
+}
+
+// newRSVPGuard sets up the limits configured in config
+func newRSVPGuard() *rsvpGuard {
+	g := &rsvpGuard{
+		perIP:     ratelimit.NewLimiter(config.RSVPIPRate),
+		perClient: ratelimit.NewLimiter(config.RSVPClientRate),
+	}
+	if config.DuplicateRSVPWindow > 0 {
+		g.recent = ratelimit.NewRecent(config.DuplicateRSVPWindow)
+	}
+	return g
+}
+
+// limitRSVP wraps a public RSVP handler with the per-IP rate limit and the body size cap.
+// Admins are not limited.
+func (h *Handler) limitRSVP(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auth.FromContext(r.Context()).IsAdmin() {
+			ip := clientIP(r)
+			if ok, wait := h.rsvp.perIP.Allow(ip); !ok {
+				log.Printf("RSVP rate limit reached by %s", ip)
+				apperror.Write(w, apperror.RateLimited(wait, "too many RSVPs from this address, try again later"))
+				return
+			}
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, config.MaxRSVPBodyBytes)
+		next(w, r)
+	}
+}
+
+// allowClientRSVP applies the per-client rate limit, which caps what a flood spread over many
+// addresses can post to one couple's wall
+func (h *Handler) allowClientRSVP(r *http.Request, clientID primitive.ObjectID) error {
+	if auth.FromContext(r.Context()).IsAdmin() {
+		return nil
+	}
+	if ok, wait := h.rsvp.perClient.Allow(clientID.Hex()); !ok {
+		log.Printf("RSVP rate limit reached for client %s", clientID.Hex())
+		return apperror.RateLimited(wait, "this invitation is receiving too many RSVPs, try again later")
+	}
+	return nil
+}
+
+// claimRSVP records a new anonymous RSVP's name and message, and rejects it when the same pair
+// was sent to the client within the duplicate window. The returned release undoes the claim when the
+// RSVP could not be stored.
+func (h *Handler) claimRSVP(clientID primitive.ObjectID, name, message string) (release func(), err error) {
+	if h.rsvp.recent == nil {
+		return func() {}, nil
+	}
+	sum := sha256.Sum256([]byte(clientID.Hex() + "\x00" + normalizeRSVPText(name) + "\x00" + normalizeRSVPText(message)))
+	key := hex.EncodeToString(sum[:])
+	if h.rsvp.recent.Seen(key) {
+		return nil, apperror.Conflict("this RSVP was already received")
+	}
+	return func() { h.rsvp.recent.Forget(key) }, nil
+}
+
+// normalizeRSVPText lowercases s and collapses whitespace, so trivially edited copies still match
+func normalizeRSVPText(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// clientIP returns the caller's address. Behind config.TrustedProxyHops proxies it is the
+// X-Forwarded-For entry the outermost proxy added, counting from the right: the entries to its
+// left come from the caller, who can set them to anything.
+func clientIP(r *http.Request) string {
+	if hops := config.TrustedProxyHops; hops > 0 {
+		var entries []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			entries = append(entries, strings.Split(header, ",")...)
+		}
+		if len(entries) >= hops {
+			if ip := strings.TrimSpace(entries[len(entries)-hops]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/auth"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// GetClientStats reports how many guests are coming and how the responses arrived over time.
+// The optional tz query parameter (an IANA name such as Asia/Jakarta) sets the timeline's day boundaries.
+func (h *Handler) GetClientStats(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	clientID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+	if !auth.Authorize(w, r, auth.FromContext(r.Context()).CanManageClient(clientID)) {
+		return
+	}
+
+	loc, err := parseTimeZone(r.URL.Query().Get("tz"))
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	stats, err := h.Guests.GetClientStats(r.Context(), clientID, loc)
+	if err != nil {
+		log.Printf("Error computing client stats: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// parseTimeZone reads the optional tz query parameter, defaulting to UTC
+func parseTimeZone(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, apperror.InvalidField("tz", "unknown time zone %q", tz)
+	}
+	return loc, nil
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/auth"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	ownerTokenTTL = 30 * 24 * time.Hour
+	guestTokenTTL = 180 * 24 * time.Hour
+)
+
+// tokenResponse is returned whenever the API hands out a bearer token
+type tokenResponse struct {
+	Token     string    `json:"token"`
+	Role      auth.Role `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// issueGuestToken returns a token letting a guest view and edit only their own RSVP
+func (h *Handler) issueGuestToken(guestID, clientID primitive.ObjectID) (string, error) {
+	token, _, err := h.Auth.Issue(auth.Principal{
+		Role:     auth.RoleGuest,
+		Subject:  guestID.Hex(),
+		ClientID: clientID,
+		GuestID:  guestID,
+	}, guestTokenTTL)
+	return token, err
+}
+
+// IssueOwnerToken lets an admin hand a couple a token scoped to their own client
+func (h *Handler) IssueOwnerToken(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	clientID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	if _, err := h.Clients.GetClientByID(r.Context(), clientID); err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	token, expiresAt, err := h.Auth.Issue(auth.Principal{
+		Role:     auth.RoleOwner,
+		Subject:  clientID.Hex(),
+		ClientID: clientID,
+	}, ownerTokenTTL)
+	if err != nil {
+		log.Printf("Error issuing owner token: %v", err)
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokenResponse{Token: token, Role: auth.RoleOwner, ExpiresAt: expiresAt})
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/audit"
+	"deili-backend/internal/client"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// restoreClientResponse reports a restored client and the guests trashed along with it
+type restoreClientResponse struct {
+	Client         clientResponse `json:"client"`
+	RestoredGuests int64          `json:"restored_guests"`
+}
+
+// GetDeletedClients lists the clients in the trash, see parseListQuery for the query parameters
+func (h *Handler) GetDeletedClients(w http.ResponseWriter, r *http.Request) {
+	q, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	page, err := h.Clients.ListDeletedClients(r.Context(), q)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(convertPage(page, newClientResponse))
+}
+
+// GetDeletedGuests lists the guests in the trash, optionally only those of client_id
+func (h *Handler) GetDeletedGuests(w http.ResponseWriter, r *http.Request) {
+	var clientID primitive.ObjectID
+	if value := r.URL.Query().Get("client_id"); value != "" {
+		id, err := parseObjectID(value, "client_id")
+		if err != nil {
+			apperror.Write(w, err)
+			return
+		}
+		clientID = id
+	}
+	q, err := parseListQuery(r.URL.Query())
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	page, err := h.Guests.ListDeletedGuests(r.Context(), clientID, q)
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(convertPage(page, newGuestResponse))
+}
+
+// RestoreClient takes a client out of the trash together with the guests deleted with it
+func (h *Handler) RestoreClient(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	clientID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	var restoredClient *client.Client
+	var report restoreClientResponse
+	err = h.Tx.WithTransaction(r.Context(), func(ctx context.Context) error {
+		trashed, err := h.Clients.RestoreClient(ctx, clientID)
+		if err != nil {
+			return err
+		}
+		restored, err := h.Guests.RestoreGuestsByClient(ctx, clientID, *trashed.DeletedAt)
+		if err != nil {
+			return err
+		}
+
+		trashed.DeletedAt = nil
+		restoredClient = trashed
+		report = restoreClientResponse{Client: newClientResponse(*trashed), RestoredGuests: restored}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error restoring client %s: %v", clientID.Hex(), err)
+		apperror.Write(w, err)
+		return
+	}
+	h.recordAudit(r, audit.NewEntry(r.Context(), audit.ActionRestore, audit.ResourceClient, clientID, clientID, nil, clientSnapshot(restoredClient)))
+	h.tenants.Forget(append([]string{restoredClient.Slug}, restoredClient.VerifiedHosts...)...)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// RestoreGuest takes a guest out of the trash; its client has to be restored first
+func (h *Handler) RestoreGuest(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	guestID, err := parseObjectID(params["id"], "id")
+	if err != nil {
+		apperror.Write(w, err)
+		return
+	}
+
+	restored, err := h.Guests.RestoreGuest(r.Context(), guestID)
+	if err != nil {
+		log.Printf("Error restoring guest %s: %v", guestID.Hex(), err)
+		apperror.Write(w, err)
+		return
+	}
+	// The guest held these seats when it was trashed, so it gets them back even past capacity
+	h.moveSeats(r.Context(), restored.EventRSVPs, 1)
+	h.recordAudit(r, audit.NewEntry(r.Context(), audit.ActionRestore, audit.ResourceGuest, guestID, restored.ClientID, nil, guestSnapshot(restored)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newGuestResponse(*restored))
+}
@@ -56,82 +56,91 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"deili-backend/api"
 	"deili-backend/config"
+	"deili-backend/database"
+	"deili-backend/internal/audit"
+	"deili-backend/internal/auth"
 	"deili-backend/internal/client"
+	"deili-backend/internal/event"
 	"deili-backend/internal/guest"
+	"deili-backend/internal/idempotency"
+	"deili-backend/internal/maintenance"
+	"deili-backend/internal/migrate"
+	"deili-backend/internal/origins"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// isAllowedOrigin checks if the request origin is allowed for CORS.
-func isAllowedOrigin(origin string) bool {
-	// Allow main domain and any subdomain under `deiliinvitation.com`
-	if origin == "https://deiliinvitation.com" || strings.HasSuffix(origin, ".deiliinvitation.com") {
-		return true
-	}
-	// Allow localhost for local development
-	return origin == "http://localhost:3000" || origin == "https://localhost:3000"
-}
+// HTTP server timeouts; WriteTimeout bounds the slowest handler we expect to serve.
+const (
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 15 * time.Second
+	writeTimeout      = 30 * time.Second
+	idleTimeout       = 60 * time.Second
+)
 
-// connectMongoDB establishes a connection to MongoDB using the URI from Render's environment.
-func connectMongoDB() *mongo.Client {
-	mongoURI := os.Getenv("MONGODB_URI")
-	if mongoURI == "" {
-		log.Fatal("MONGODB_URI environment variable is not set")
-	}
+// purgeInterval is how often records past the trash retention period are deleted for good.
+const purgeInterval = time.Hour
 
-	clientOptions := options.Client().ApplyURI(mongoURI)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+func main() {
+	// Load environment configuration
+	config.LoadEnv()
 
-	client, err := mongo.Connect(ctx, clientOptions)
+	// Open the single MongoDB connection shared by the client and guest modules
+	db, err := database.Connect(context.Background(), config.MongoURI, config.DBName)
 	if err != nil {
 		log.Fatalf("Failed to connect to MongoDB: %v", err)
 	}
-
-	// Ping the MongoDB server to verify the connection
-	if err := client.Ping(ctx, nil); err != nil {
-		log.Fatalf("Could not ping MongoDB: %v", err)
-	}
-
-	fmt.Println("Connected to MongoDB!")
-	return client
-}
-
-func main() {
-	// Load environment configuration, initialize client and guest modules
-	config.LoadEnv()
-	client.Init()
-	guest.Init()
-
-	// Initialize MongoDB connection
-	dbClient := connectMongoDB()
 	defer func() {
-		if err := dbClient.Disconnect(context.Background()); err != nil {
-			log.Fatalf("Error disconnecting from MongoDB: %v", err)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := db.Disconnect(ctx); err != nil {
+			log.Printf("Error disconnecting from MongoDB: %v", err)
 		}
 	}()
 
+	clientStore := client.NewMongoStore(db.Database())
+	guestStore := guest.NewMongoStore(db.Database())
+	eventStore := event.NewMongoStore(db.Database())
+	auditStore := audit.NewMongoStore(db.Database())
+	idempotencyStore := idempotency.NewMongoStore(db.Database())
+
+	// Bring indexes, validators and stored data up to date; among others, concurrent
+	// idempotent retries are only safe once the unique key index exists
+	if config.MigrateOnStart {
+		if _, err := migrate.NewRunner(db.Database(), migrate.All).Up(context.Background()); err != nil {
+			log.Fatalf("Failed to apply database migrations: %v", err)
+		}
+	}
+
 	// Set up the router and register API routes
 	r := mux.NewRouter()
-	api.RegisterRoutes(r)
-
-	// Set up CORS middleware with dynamic origin validation for subdomains and main domain
+	authenticator := auth.NewAuthenticator(config.AuthSecret, config.AdminAPIKey)
+	api.RegisterRoutes(r, api.NewHandler(clientStore, guestStore, eventStore, auditStore, idempotencyStore, db, authenticator))
+
+	// Allow the platform domain, its subdomains, the configured origins and the couples'
+	// verified custom domains; a failed first load only delays the custom domains
+	allowList := origins.NewAllowList(config.TenantDomain, config.AllowedOrigins, clientStore.ListVerifiedDomains)
+	if err := allowList.Refresh(context.Background()); err != nil {
+		log.Printf("Error loading custom domains for CORS: %v", err)
+	}
 	corsMiddleware := handlers.CORS(
-		handlers.AllowedOriginValidator(isAllowedOrigin),
-		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-		handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+		handlers.AllowedOriginValidator(allowList.Allowed),
+		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "Authorization", idempotency.Header, "If-Match"}),
+		// Browsers only let the frontend read the ETag it sends back in If-Match when it is exposed
+		handlers.ExposedHeaders([]string{"ETag"}),
 		handlers.AllowCredentials(),
 	)
 
@@ -141,7 +150,50 @@ func main() {
 		port = "8080"
 	}
 
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           corsMiddleware(r),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+
+	// Stop accepting new work on SIGINT/SIGTERM so in-flight RSVPs can finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Permanently delete records that have been in the trash for longer than the retention period
+	purger := &maintenance.Purger{
+		Clients:   clientStore,
+		Guests:    guestStore,
+		Events:    eventStore,
+		Retention: config.TrashRetention,
+	}
+	go purger.Run(ctx, purgeInterval)
+	go allowList.Run(ctx, config.OriginsRefreshInterval)
+
 	// Start the server with CORS middleware applied to the router
-	fmt.Printf("Server is running on port %s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, corsMiddleware(r)))
+	serverErr := make(chan error, 1)
+	go func() {
+		fmt.Printf("Server is running on port %s\n", port)
+		serverErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP server error: %v", err)
+		}
+	case <-ctx.Done():
+		log.Printf("Shutdown signal received, draining connections for up to %s", config.ShutdownTimeout)
+	}
+
+	// Drain in-flight requests before the deferred MongoDB disconnect runs
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server did not drain cleanly: %v", err)
+	}
+	log.Printf("HTTP server stopped")
 }
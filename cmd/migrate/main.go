@@ -0,0 +1,70 @@
+// Command migrate applies pending database migrations, or lists them with -status.
+//
+// It reads MONGO_URI and DB_NAME like the API server, which applies the same migrations at
+// startup unless MIGRATE_ON_START is false. Running it as a release step keeps slow index
+// builds and backfills out of the server's startup.
+package main
+
+import (
+	"context"
+	"deili-backend/config"
+	"deili-backend/database"
+	"deili-backend/internal/migrate"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func main() {
+	status := flag.Bool("status", false, "list the migrations and whether they were applied, without applying any")
+	flag.Parse()
+
+	config.LoadDatabaseEnv()
+
+	ctx := context.Background()
+	db, err := database.Connect(ctx, config.MongoURI, config.DBName)
+	if err != nil {
+		log.Fatalf("Error connecting to MongoDB: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := db.Disconnect(ctx); err != nil {
+			log.Printf("Error disconnecting from MongoDB: %v", err)
+		}
+	}()
+
+	runner := migrate.NewRunner(db.Database(), migrate.All)
+	if *status {
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			log.Fatalf("Error reading migrations: %v", err)
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tDESCRIPTION\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.Applied != nil {
+				applied = s.Applied.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Migration.Version, s.Migration.Description, applied)
+		}
+		tw.Flush()
+		return
+	}
+
+	applied, err := runner.Up(ctx)
+	for _, m := range applied {
+		fmt.Printf("Applied migration %d: %s\n", m.Version, m.Description)
+	}
+	if err != nil {
+		db.Disconnect(context.Background())
+		log.Fatalf("Error applying migrations: %v", err)
+	}
+	if len(applied) == 0 {
+		fmt.Println("The database is up to date")
+	}
+}
@@ -0,0 +1,68 @@
+// Command orphans reports guests and events whose client no longer exists.
+//
+// It reads MONGO_URI and DB_NAME like the API server and exits with status 1 when -fail is set
+// and orphans were found, so it can run as a scheduled check.
+package main
+
+import (
+	"context"
+	"deili-backend/config"
+	"deili-backend/database"
+	"deili-backend/internal/maintenance"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func main() {
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	failOnOrphans := flag.Bool("fail", false, "exit with status 1 when orphans are found")
+	flag.Parse()
+
+	config.LoadDatabaseEnv()
+
+	ctx := context.Background()
+	db, err := database.Connect(ctx, config.MongoURI, config.DBName)
+	if err != nil {
+		log.Fatalf("Error connecting to MongoDB: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := db.Disconnect(ctx); err != nil {
+			log.Printf("Error disconnecting from MongoDB: %v", err)
+		}
+	}()
+
+	report, err := maintenance.FindOrphans(ctx, db.Database())
+	if err != nil {
+		log.Fatalf("Error looking for orphans: %v", err)
+	}
+
+	if *asJSON {
+		if report == nil {
+			report = []maintenance.Orphans{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else if len(report) == 0 {
+		fmt.Println("No orphaned documents found")
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "COLLECTION\tMISSING CLIENT\tDOCUMENTS")
+		for _, o := range report {
+			fmt.Fprintf(tw, "%s\t%s\t%d\n", o.Collection, o.ClientID.Hex(), o.Count)
+		}
+		tw.Flush()
+	}
+
+	if *failOnOrphans && len(report) > 0 {
+		db.Disconnect(context.Background())
+		os.Exit(1)
+	}
+}
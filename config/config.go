@@ -1,16 +1,190 @@
 package config
 
 import (
+	"deili-backend/internal/ratelimit"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // MongoURI and DBName are global variables that hold the database URI and database name.
 var MongoURI string
 var DBName string
 
-// LoadEnv retrieves environment variables for MongoDB configuration.
+// AuthSecret signs bearer tokens; AdminAPIKey, when set, is accepted as an admin bearer credential.
+var AuthSecret string
+var AdminAPIKey string
+
+// InvitationBaseURL is the frontend origin personalized invitation links point at.
+var InvitationBaseURL = "https://deiliinvitation.com"
+
+// TenantDomain is the domain couples get their site under; a request from one of its
+// subdomains is for the client with that slug.
+var TenantDomain = "deiliinvitation.com"
+
+// AllowedOrigins are browser origins allowed to call the API besides TenantDomain, its
+// subdomains and the verified custom domains of the clients.
+var AllowedOrigins = []string{"http://localhost:3000", "https://localhost:3000"}
+
+// OriginsRefreshInterval is how often the custom domains allowed by CORS are reloaded.
+var OriginsRefreshInterval = time.Minute
+
+// ShutdownTimeout is how long the HTTP server waits for in-flight requests to finish on shutdown.
+var ShutdownTimeout = 30 * time.Second
+
+// MessageBlocklist holds words that hold a guest message for the couple's review instead of
+// publishing it straight away.
+var MessageBlocklist []string
+
+// TrashRetention is how long deleted clients and guests stay restorable before they are purged.
+var TrashRetention = 30 * 24 * time.Hour
+
+// IdempotencyTTL is how long a POST response is kept for retries sent with the same Idempotency-Key.
+var IdempotencyTTL = 24 * time.Hour
+
+// RSVPIPRate and RSVPClientRate limit public RSVP submissions per caller IP and per client.
+var RSVPIPRate = ratelimit.Rate{Limit: 10, Per: time.Minute}
+var RSVPClientRate = ratelimit.Rate{Limit: 120, Per: time.Minute}
+
+// MaxRSVPBodyBytes caps the size of a public RSVP request body.
+var MaxRSVPBodyBytes int64 = 16 << 10
+
+// DuplicateRSVPWindow is how long an RSVP with the same name and message is rejected as a resubmission.
+var DuplicateRSVPWindow = 10 * time.Minute
+
+// TrustedProxyHops is how many proxies in front of the API append the address they received a
+// request from to X-Forwarded-For. Rate limits key callers by the entry the outermost one added;
+// with zero, the header is ignored, since callers can set it to anything.
+var TrustedProxyHops int
+
+// MigrateOnStart makes the API server apply pending database migrations before it starts
+// serving; deployments that run cmd/migrate as a release step turn it off.
+var MigrateOnStart = true
+
+// LoadEnv retrieves the environment variables the API server needs.
 func LoadEnv() {
+	LoadDatabaseEnv()
+
+	// Get the token signing secret from the environment
+	AuthSecret = os.Getenv("AUTH_SECRET")
+	if len(AuthSecret) < 32 {
+		log.Fatal("AUTH_SECRET environment variable must be set to at least 32 characters")
+	}
+	AdminAPIKey = os.Getenv("ADMIN_API_KEY")
+
+	if value := os.Getenv("INVITATION_BASE_URL"); value != "" {
+		InvitationBaseURL = value
+	}
+	if value := os.Getenv("TENANT_DOMAIN"); value != "" {
+		TenantDomain = value
+	}
+
+	// Optional comma-separated list of origins replacing the local development defaults
+	if value, ok := os.LookupEnv("CORS_ALLOWED_ORIGINS"); ok {
+		AllowedOrigins = nil
+		for _, origin := range strings.Split(value, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				AllowedOrigins = append(AllowedOrigins, origin)
+			}
+		}
+	}
+	if value := os.Getenv("CORS_REFRESH_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			log.Fatalf("CORS_REFRESH_INTERVAL must be a positive duration, got %q", value)
+		}
+		OriginsRefreshInterval = interval
+	}
+
+	// Optional drain period for graceful shutdown, e.g. "45s"
+	if value := os.Getenv("SHUTDOWN_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			log.Fatalf("SHUTDOWN_TIMEOUT must be a positive duration, got %q", value)
+		}
+		ShutdownTimeout = timeout
+	}
+
+	// Optional comma-separated list of words, e.g. "spam,casino"
+	for _, word := range strings.Split(os.Getenv("MESSAGE_BLOCKLIST"), ",") {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			MessageBlocklist = append(MessageBlocklist, word)
+		}
+	}
+
+	// Optional retention period for deleted records, e.g. "720h"
+	if value := os.Getenv("TRASH_RETENTION"); value != "" {
+		retention, err := time.ParseDuration(value)
+		if err != nil || retention <= 0 {
+			log.Fatalf("TRASH_RETENTION must be a positive duration, got %q", value)
+		}
+		TrashRetention = retention
+	}
+
+	// Optional lifetime of stored idempotent responses, e.g. "12h"
+	if value := os.Getenv("IDEMPOTENCY_TTL"); value != "" {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			log.Fatalf("IDEMPOTENCY_TTL must be a positive duration, got %q", value)
+		}
+		IdempotencyTTL = ttl
+	}
+
+	if value := os.Getenv("MIGRATE_ON_START"); value != "" {
+		migrate, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Fatalf("MIGRATE_ON_START must be true or false, got %q", value)
+		}
+		MigrateOnStart = migrate
+	}
+
+	loadRSVPLimits()
+}
+
+// loadRSVPLimits reads the optional spam protection settings for public RSVPs
+func loadRSVPLimits() {
+	// Rates are written as requests per period, e.g. "10/1m"
+	for name, rate := range map[string]*ratelimit.Rate{"RSVP_IP_RATE": &RSVPIPRate, "RSVP_CLIENT_RATE": &RSVPClientRate} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := ratelimit.ParseRate(value)
+			if err != nil {
+				log.Fatalf("%s: %v", name, err)
+			}
+			*rate = parsed
+		}
+	}
+
+	if value := os.Getenv("RSVP_MAX_BODY_BYTES"); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size <= 0 {
+			log.Fatalf("RSVP_MAX_BODY_BYTES must be a positive number of bytes, got %q", value)
+		}
+		MaxRSVPBodyBytes = size
+	}
+
+	// A zero window turns duplicate detection off
+	if value := os.Getenv("RSVP_DUPLICATE_WINDOW"); value != "" {
+		window, err := time.ParseDuration(value)
+		if err != nil || window < 0 {
+			log.Fatalf("RSVP_DUPLICATE_WINDOW must be a duration, got %q", value)
+		}
+		DuplicateRSVPWindow = window
+	}
+
+	if value := os.Getenv("TRUSTED_PROXY_HOPS"); value != "" {
+		hops, err := strconv.Atoi(value)
+		if err != nil || hops < 0 {
+			log.Fatalf("TRUSTED_PROXY_HOPS must be a number of proxies, got %q", value)
+		}
+		TrustedProxyHops = hops
+	}
+}
+
+// LoadDatabaseEnv retrieves environment variables for MongoDB configuration. Maintenance
+// commands that only talk to the database call it instead of LoadEnv.
+func LoadDatabaseEnv() {
 	// Get MongoDB connection URI from the environment
 	MongoURI = os.Getenv("MONGO_URI")
 	if MongoURI == "" {
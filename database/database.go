@@ -2,49 +2,151 @@ package database
 
 import (
 	"context"
-	"crypto/tls"
+	"fmt"
 	"log"
-	"os"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func ConnectToMongoDB() (*mongo.Client, error) {
-	uri := os.Getenv("MONGO_URI")
-	if uri == "" {
-		log.Fatal("MONGO_URI environment variable is not set")
-	}
+const (
+	maxConnectAttempts = 5
+	initialBackoff     = 1 * time.Second
+	maxBackoff         = 16 * time.Second
+)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// Manager owns the single MongoDB connection shared by every domain package
+type Manager struct {
+	client   *mongo.Client
+	database *mongo.Database
+	// supportsTransactions is false for standalone servers, which reject multi-document transactions
+	supportsTransactions bool
+}
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: true,
-	}
+// Transactor runs a unit of work atomically where the storage allows it
+type Transactor interface {
+	// WithTransaction calls fn with a context every store operation inside fn must use
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
 
+var _ Transactor = (*Manager)(nil)
+
+// Connect opens the MongoDB connection, retrying with exponential backoff until a ping succeeds
+func Connect(ctx context.Context, uri, dbName string) (*Manager, error) {
 	clientOptions := options.Client().ApplyURI(uri).
 		SetServerSelectionTimeout(10 * time.Second).
 		SetConnectTimeout(15 * time.Second).
-		SetSocketTimeout(30 * time.Second).
-		SetTLSConfig(tlsConfig)
+		SetSocketTimeout(30 * time.Second)
 
-	var client *mongo.Client
+	backoff := initialBackoff
 	var err error
-
-	for retries := 0; retries < 5; retries++ {
-		client, err = mongo.Connect(ctx, clientOptions)
+	for attempt := 1; attempt <= maxConnectAttempts; attempt++ {
+		var client *mongo.Client
+		client, err = connectAndPing(ctx, clientOptions)
 		if err == nil {
-			err = client.Ping(ctx, nil)
-			if err == nil {
-				log.Printf("Successfully connected to MongoDB on attempt %d", retries+1)
-				return client, nil
-			}
+			log.Printf("Successfully connected to MongoDB on attempt %d", attempt)
+			m := &Manager{client: client, database: client.Database(dbName)}
+			m.supportsTransactions = detectTransactions(ctx, client)
+			return m, nil
+		}
+		log.Printf("Failed to connect to MongoDB on attempt %d: %v", attempt, err)
+
+		if attempt == maxConnectAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
 		}
-		log.Printf("Failed to connect to MongoDB on attempt %d: %v", retries+1, err)
-		time.Sleep(time.Duration(retries+1) * 2 * time.Second)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+
+	return nil, fmt.Errorf("could not connect to MongoDB after %d attempts: %w", maxConnectAttempts, err)
+}
+
+// connectAndPing makes a single connection attempt and verifies it with a ping
+func connectAndPing(ctx context.Context, clientOptions *options.ClientOptions) (*mongo.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		_ = client.Disconnect(context.Background())
+		return nil, err
 	}
+	return client, nil
+}
+
+// Database returns the application database handed to the domain stores
+func (m *Manager) Database() *mongo.Database {
+	return m.database
+}
+
+// Client returns the underlying driver client, e.g. for starting sessions
+func (m *Manager) Client() *mongo.Client {
+	return m.client
+}
+
+// Disconnect closes the connection pool, waiting for in-use connections up to the context deadline
+func (m *Manager) Disconnect(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+// WithTransaction runs fn in a multi-document transaction on replica sets and sharded clusters.
+// fn may be retried on transient errors, so it must be safe to run more than once. Standalone
+// servers cannot run transactions, so there fn runs on its own.
+func (m *Manager) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !m.supportsTransactions {
+		return fn(ctx)
+	}
+
+	session, err := m.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// detectTransactions asks the server whether it is part of a replica set or a sharded cluster
+func detectTransactions(ctx context.Context, client *mongo.Client) bool {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		log.Printf("Could not detect MongoDB topology, running without transactions: %v", err)
+		return false
+	}
+	if hello.SetName == "" && hello.Msg != "isdbgrid" {
+		log.Printf("MongoDB is a standalone server, running without transactions")
+		return false
+	}
+	return true
+}
+
+// NoTransactions runs units of work directly, for in-memory stores
+type NoTransactions struct{}
+
+var _ Transactor = NoTransactions{}
 
-	return nil, err
+func (NoTransactions) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
 }
@@ -0,0 +1,184 @@
+// Package apperror defines the typed errors domain code returns and the JSON body handlers
+// turn them into, so every failure reaches the client with the right status and a
+// machine-readable code.
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Code is the machine-readable kind of an error, sent to clients as "code"
+type Code string
+
+const (
+	CodeValidation         Code = "validation_failed"
+	CodeNotFound           Code = "not_found"
+	CodeConflict           Code = "conflict"
+	CodePreconditionFailed Code = "precondition_failed"
+	CodeUnauthorized       Code = "unauthorized"
+	CodeForbidden          Code = "forbidden"
+	CodeMethodNotAllowed   Code = "method_not_allowed"
+	CodePayloadTooLarge    Code = "payload_too_large"
+	CodeRateLimited        Code = "rate_limited"
+	CodeUnavailable        Code = "unavailable"
+	CodeInternal           Code = "internal_error"
+)
+
+var statusByCode = map[Code]int{
+	CodeValidation:         http.StatusBadRequest,
+	CodeNotFound:           http.StatusNotFound,
+	CodeConflict:           http.StatusConflict,
+	CodePreconditionFailed: http.StatusPreconditionFailed,
+	CodeUnauthorized:       http.StatusUnauthorized,
+	CodeForbidden:          http.StatusForbidden,
+	CodeMethodNotAllowed:   http.StatusMethodNotAllowed,
+	CodePayloadTooLarge:    http.StatusRequestEntityTooLarge,
+	CodeRateLimited:        http.StatusTooManyRequests,
+	CodeUnavailable:        http.StatusServiceUnavailable,
+	CodeInternal:           http.StatusInternalServerError,
+}
+
+// Error is an error safe to show to API clients. Message and Fields are sent as they are;
+// the wrapped cause is only logged.
+type Error struct {
+	Code    Code
+	Message string
+	// Fields maps request fields to what is wrong with them
+	Fields map[string]string
+	// RetryAfter, when set, tells the client how long to wait before trying again
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status is the HTTP status code the error is served with
+func (e *Error) Status() int {
+	if status, ok := statusByCode[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// WithField returns a copy of the error that also reports a problem with one request field
+func (e *Error) WithField(field, problem string) *Error {
+	c := *e
+	c.Fields = make(map[string]string, len(e.Fields)+1)
+	for k, v := range e.Fields {
+		c.Fields[k] = v
+	}
+	c.Fields[field] = problem
+	return &c
+}
+
+// Wrap returns a copy of the error wrapping cause, so errors.Is still matches domain sentinels
+func (e *Error) Wrap(cause error) *Error {
+	c := *e
+	c.Err = cause
+	return &c
+}
+
+// New returns an error of the given kind
+func New(code Code, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Validation reports a request that is malformed or breaks a business rule
+func Validation(format string, args ...any) *Error {
+	return New(CodeValidation, format, args...)
+}
+
+// InvalidField reports a problem with a single request field
+func InvalidField(field, format string, args ...any) *Error {
+	problem := fmt.Sprintf(format, args...)
+	return Validation("%s: %s", field, problem).WithField(field, problem)
+}
+
+// NotFound reports that a resource, e.g. "client", does not exist
+func NotFound(resource string) *Error {
+	return New(CodeNotFound, "%s not found", resource).Wrap(mongo.ErrNoDocuments)
+}
+
+// Conflict reports a request that clashes with the current state, such as a duplicate
+func Conflict(format string, args ...any) *Error {
+	return New(CodeConflict, format, args...)
+}
+
+// PreconditionFailed reports a conditional request, e.g. one sent with If-Match, whose
+// condition no longer holds
+func PreconditionFailed(format string, args ...any) *Error {
+	return New(CodePreconditionFailed, format, args...)
+}
+
+// Unauthorized reports missing or invalid credentials
+func Unauthorized(format string, args ...any) *Error {
+	return New(CodeUnauthorized, format, args...)
+}
+
+// Forbidden reports credentials that do not grant access to the resource
+func Forbidden(format string, args ...any) *Error {
+	return New(CodeForbidden, format, args...)
+}
+
+// RateLimited reports a caller that sent too many requests and may retry after wait
+func RateLimited(wait time.Duration, format string, args ...any) *Error {
+	e := New(CodeRateLimited, format, args...)
+	e.RetryAfter = wait
+	return e
+}
+
+// From classifies any error. Typed errors are returned as they are, a driver "no documents"
+// becomes not found, duplicate keys become conflicts and everything else is internal.
+func From(err error) *Error {
+	var appErr *Error
+	switch {
+	case errors.As(err, &appErr):
+		return appErr
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return NotFound("resource")
+	case mongo.IsDuplicateKeyError(err):
+		return Conflict("resource already exists").Wrap(err)
+	default:
+		return New(CodeInternal, "internal server error").Wrap(err)
+	}
+}
+
+// body is the JSON every error response carries
+type body struct {
+	Code    Code              `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// Write serves err as a JSON error response. Internal errors are logged and their details
+// kept from the client.
+func Write(w http.ResponseWriter, err error) {
+	appErr := From(err)
+	if appErr.Code == CodeInternal {
+		log.Printf("Internal error: %v", appErr.Err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if appErr.RetryAfter > 0 {
+		// Retry-After is in whole seconds; round up so a client retrying on time is let through
+		seconds := (appErr.RetryAfter + time.Second - 1) / time.Second
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(seconds), 10))
+	}
+	w.WriteHeader(appErr.Status())
+	json.NewEncoder(w).Encode(body{Code: appErr.Code, Message: appErr.Message, Fields: appErr.Fields})
+}
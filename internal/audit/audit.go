@@ -0,0 +1,161 @@
+// Package audit records who changed which client or guest, when, and how. Entries are written
+// by the API handlers after a change succeeds and are kept in their own collection.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"deili-backend/internal/auth"
+	"deili-backend/internal/listing"
+	"deili-backend/internal/requestid"
+	"deili-backend/internal/revision"
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Action is the kind of change an entry records
+type Action string
+
+const (
+	ActionCreate  Action = "create"
+	ActionUpdate  Action = "update"
+	ActionDelete  Action = "delete"
+	ActionRestore Action = "restore"
+)
+
+// ResourceType is the kind of record that was changed
+type ResourceType string
+
+const (
+	ResourceClient ResourceType = "client"
+	ResourceGuest  ResourceType = "guest"
+)
+
+// Actor is the caller who made a change
+type Actor struct {
+	Role auth.Role `bson:"role" json:"role"`
+	// Subject identifies the caller within its role, e.g. the guest ID for guests
+	Subject string `bson:"subject,omitempty" json:"subject,omitempty"`
+}
+
+// Change is the value of one field before and after a change; a missing side is null
+type Change struct {
+	Before any `bson:"before" json:"before"`
+	After  any `bson:"after" json:"after"`
+}
+
+// Entry is one recorded change
+type Entry struct {
+	ID primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	At time.Time          `bson:"at" json:"at"`
+	// ClientID is the client the changed record belongs to, so entries can be listed per client
+	ClientID     primitive.ObjectID `bson:"client_id" json:"client_id"`
+	Actor        Actor              `bson:"actor" json:"actor"`
+	Action       Action             `bson:"action" json:"action"`
+	ResourceType ResourceType       `bson:"resource_type" json:"resource_type"`
+	ResourceID   primitive.ObjectID `bson:"resource_id" json:"resource_id"`
+	// Changes maps the JSON field names that differ to their old and new values
+	Changes   map[string]Change `bson:"changes,omitempty" json:"changes,omitempty"`
+	RequestID string            `bson:"request_id,omitempty" json:"request_id,omitempty"`
+}
+
+// NewEntry describes a change made by the principal and request in ctx. before is nil for
+// creations and restores and after is nil for deletions, so those entries hold the whole
+// record; otherwise Changes are only the fields that differ.
+func NewEntry(ctx context.Context, action Action, resourceType ResourceType, resourceID, clientID primitive.ObjectID, before, after any) Entry {
+	principal := auth.FromContext(ctx)
+	return Entry{
+		ID:           primitive.NewObjectID(),
+		At:           revision.Now(),
+		ClientID:     clientID,
+		Actor:        Actor{Role: principal.Role, Subject: principal.Subject},
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		Changes:      Diff(before, after),
+		RequestID:    requestid.FromContext(ctx),
+	}
+}
+
+// Diff compares the JSON forms of two values field by field and returns the fields that
+// differ. Either value may be nil; values that cannot be encoded as JSON count as empty.
+func Diff(before, after any) map[string]Change {
+	prev, next := fields(before), fields(after)
+	changes := map[string]Change{}
+	// A missing field and a null one are the same, so created and deleted records only list
+	// the fields that hold something
+	for name, value := range prev {
+		other, ok := next[name]
+		if !ok {
+			other = null
+		}
+		if !bytes.Equal(value, other) {
+			changes[name] = Change{Before: decode(value), After: decode(other)}
+		}
+	}
+	for name, value := range next {
+		if _, ok := prev[name]; !ok && !bytes.Equal(value, null) {
+			changes[name] = Change{After: decode(value)}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+var null = json.RawMessage("null")
+
+// fields returns the top-level JSON fields of v
+func fields(v any) map[string]json.RawMessage {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// decode turns a field's JSON back into a plain value that can be stored and served again
+func decode(raw json.RawMessage) any {
+	if raw == nil {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil
+	}
+	return v
+}
+
+// Filter narrows the entries listed for a client; zero fields match everything
+type Filter struct {
+	ResourceType ResourceType
+	ResourceID   primitive.ObjectID
+	Action       Action
+}
+
+// matches reports whether e passes the filter, for the in-memory store
+func (f Filter) matches(e Entry) bool {
+	return (f.ResourceType == "" || e.ResourceType == f.ResourceType) &&
+		(f.ResourceID.IsZero() || e.ResourceID == f.ResourceID) &&
+		(f.Action == "" || e.Action == f.Action)
+}
+
+// listKey returns the fields entries are paginated by; they have no name and sort by time
+func listKey(e Entry) (string, primitive.ObjectID) {
+	return "", e.ID
+}
+
+// Store persists audit entries
+type Store interface {
+	Record(ctx context.Context, entries ...Entry) error
+	// ListEntries returns one page of a client's entries in the order they were recorded;
+	// q must be normalized
+	ListEntries(ctx context.Context, clientID primitive.ObjectID, f Filter, q listing.Query) (*listing.Page[Entry], error)
+}
@@ -0,0 +1,51 @@
+package audit
+
+import (
+	"context"
+	"deili-backend/internal/listing"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MemoryStore is a thread-safe in-memory Store, useful for tests and local development
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries []Entry
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns an empty in-memory audit store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Record appends the entries, generating IDs for those without one
+func (s *MemoryStore) Record(ctx context.Context, entries ...Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, e := range entries {
+		if e.ID.IsZero() {
+			e.ID = primitive.NewObjectID()
+		}
+		s.entries = append(s.entries, e)
+	}
+	return nil
+}
+
+// ListEntries returns one page of a client's entries
+func (s *MemoryStore) ListEntries(ctx context.Context, clientID primitive.ObjectID, f Filter, q listing.Query) (*listing.Page[Entry], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var entries []Entry
+	for _, e := range s.entries {
+		if e.ClientID == clientID && f.matches(e) {
+			entries = append(entries, e)
+		}
+	}
+	page := listing.Paginate(entries, q, listKey)
+	return &page, nil
+}
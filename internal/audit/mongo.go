@@ -0,0 +1,74 @@
+package audit
+
+import (
+	"context"
+	"deili-backend/internal/listing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore is a Store backed by the MongoDB audit_log collection
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+var _ Store = (*MongoStore)(nil)
+
+// NewMongoStore returns a store using the audit_log collection of the given database
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	// Changed values are arbitrary JSON; decode nested documents as maps so they serve as JSON objects
+	opts := options.Collection().SetBSONOptions(&options.BSONOptions{DefaultDocumentM: true})
+	return &MongoStore{collection: db.Collection("audit_log", opts)}
+}
+
+// Record inserts the entries in one batch
+func (s *MongoStore) Record(ctx context.Context, entries ...Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	docs := make([]interface{}, len(entries))
+	for i, e := range entries {
+		docs[i] = e
+	}
+	_, err := s.collection.InsertMany(ctx, docs)
+	return err
+}
+
+// ListEntries retrieves one page of a client's entries
+func (s *MongoStore) ListEntries(ctx context.Context, clientID primitive.ObjectID, f Filter, q listing.Query) (*listing.Page[Entry], error) {
+	var entries []Entry
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	base := bson.M{"client_id": clientID}
+	if f.ResourceType != "" {
+		base["resource_type"] = f.ResourceType
+	}
+	if !f.ResourceID.IsZero() {
+		base["resource_id"] = f.ResourceID
+	}
+	if f.Action != "" {
+		base["action"] = f.Action
+	}
+	total, err := s.collection.CountDocuments(ctx, q.CountFilter(base), q.CountOptions())
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := s.collection.Find(ctx, q.MongoFilter(base), q.FindOptions())
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	page := listing.NewPage(entries, total, q, listKey)
+	return &page, nil
+}
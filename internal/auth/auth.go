@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Role identifies what a caller is allowed to do
+type Role string
+
+const (
+	// RoleAdmin is a platform administrator with full access to every client
+	RoleAdmin Role = "admin"
+	// RoleOwner is a couple managing their own client and its guests
+	RoleOwner Role = "owner"
+	// RoleGuest is an invitee who may only view and edit their own RSVP
+	RoleGuest Role = "guest"
+	// RoleAnonymous is any caller without credentials
+	RoleAnonymous Role = "anonymous"
+)
+
+// Principal is the authenticated caller attached to a request context
+type Principal struct {
+	Role     Role
+	Subject  string
+	ClientID primitive.ObjectID
+	GuestID  primitive.ObjectID
+}
+
+// Anonymous is the principal used when a request carries no credentials
+var Anonymous = Principal{Role: RoleAnonymous}
+
+// IsAdmin reports whether the principal is a platform administrator
+func (p Principal) IsAdmin() bool {
+	return p.Role == RoleAdmin
+}
+
+// IsAuthenticated reports whether the request carried valid credentials
+func (p Principal) IsAuthenticated() bool {
+	return p.Role != RoleAnonymous && p.Role != ""
+}
+
+// CanManageClient reports whether the principal may read or change the given client and its guests
+func (p Principal) CanManageClient(clientID primitive.ObjectID) bool {
+	if p.IsAdmin() {
+		return true
+	}
+	return p.Role == RoleOwner && !clientID.IsZero() && p.ClientID == clientID
+}
+
+// CanAccessGuest reports whether the principal may read or edit a guest belonging to clientID
+func (p Principal) CanAccessGuest(guestID, clientID primitive.ObjectID) bool {
+	if p.CanManageClient(clientID) {
+		return true
+	}
+	return p.Role == RoleGuest && !guestID.IsZero() && p.GuestID == guestID && p.ClientID == clientID
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the principal
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal attached by Middleware, or Anonymous
+func FromContext(ctx context.Context) Principal {
+	if p, ok := ctx.Value(contextKey{}).(Principal); ok {
+		return p
+	}
+	return Anonymous
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"deili-backend/internal/apperror"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Middleware attaches the caller's principal to the request context. Requests without an
+// Authorization header continue as Anonymous; a present but invalid credential is rejected with 401.
+func Middleware(a *Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), Anonymous)))
+				return
+			}
+
+			scheme, token, ok := strings.Cut(header, " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+				Unauthorized(w, "Authorization header must use the Bearer scheme")
+				return
+			}
+
+			principal, err := a.Authenticate(strings.TrimSpace(token))
+			if err != nil {
+				log.Printf("Rejected credentials: %v", err)
+				Unauthorized(w, err.Error())
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+// RequireAdmin only lets platform administrators through to next
+func RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !Authorize(w, r, FromContext(r.Context()).IsAdmin()) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Authorize writes 401 for anonymous callers or 403 for authenticated ones when allowed is false,
+// and reports whether the handler may continue
+func Authorize(w http.ResponseWriter, r *http.Request, allowed bool) bool {
+	if allowed {
+		return true
+	}
+	if !FromContext(r.Context()).IsAuthenticated() {
+		Unauthorized(w, "authentication required")
+		return false
+	}
+	apperror.Write(w, apperror.Forbidden("you do not have access to this resource"))
+	return false
+}
+
+// Unauthorized writes a 401 response with a Bearer challenge
+func Unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="deili"`)
+	apperror.Write(w, apperror.Unauthorized("%s", message))
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrInvalidToken is returned for malformed tokens or tokens with a bad signature
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken is returned for correctly signed tokens past their expiry
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// jwtHeader is the fixed header of every token we issue (HS256 JWT)
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+type claims struct {
+	Subject   string `json:"sub,omitempty"`
+	Role      Role   `json:"role"`
+	ClientID  string `json:"client_id,omitempty"`
+	GuestID   string `json:"guest_id,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Authenticator issues and verifies bearer tokens signed with a shared secret
+type Authenticator struct {
+	secret      []byte
+	adminAPIKey string
+	now         func() time.Time
+}
+
+// NewAuthenticator returns an Authenticator signing with secret. A non-empty adminAPIKey is
+// accepted as a bearer credential for the admin role, which is how the first owner tokens get issued.
+func NewAuthenticator(secret, adminAPIKey string) *Authenticator {
+	return &Authenticator{secret: []byte(secret), adminAPIKey: adminAPIKey, now: time.Now}
+}
+
+// Issue returns a signed token for the principal that expires after ttl
+func (a *Authenticator) Issue(p Principal, ttl time.Duration) (string, time.Time, error) {
+	now := a.now()
+	expiresAt := now.Add(ttl)
+	c := claims{
+		Subject:   p.Subject,
+		Role:      p.Role,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	}
+	if !p.ClientID.IsZero() {
+		c.ClientID = p.ClientID.Hex()
+	}
+	if !p.GuestID.IsZero() {
+		c.GuestID = p.GuestID.Hex()
+	}
+
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	signingInput := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + a.sign(signingInput), expiresAt, nil
+}
+
+// Authenticate resolves a bearer credential to a principal
+func (a *Authenticator) Authenticate(token string) (Principal, error) {
+	if a.adminAPIKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.adminAPIKey)) == 1 {
+		return Principal{Role: RoleAdmin, Subject: "admin-api-key"}, nil
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return Principal{}, ErrInvalidToken
+	}
+	expected := a.sign(parts[0] + "." + parts[1])
+	if !hmac.Equal([]byte(parts[2]), []byte(expected)) {
+		return Principal{}, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	var c claims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	if a.now().Unix() >= c.ExpiresAt {
+		return Principal{}, ErrExpiredToken
+	}
+
+	p := Principal{Role: c.Role, Subject: c.Subject}
+	switch c.Role {
+	case RoleAdmin:
+	case RoleOwner, RoleGuest:
+		if p.ClientID, err = primitive.ObjectIDFromHex(c.ClientID); err != nil {
+			return Principal{}, ErrInvalidToken
+		}
+		if c.Role == RoleGuest {
+			if p.GuestID, err = primitive.ObjectIDFromHex(c.GuestID); err != nil {
+				return Principal{}, ErrInvalidToken
+			}
+		}
+	default:
+		return Principal{}, ErrInvalidToken
+	}
+	return p, nil
+}
+
+func (a *Authenticator) sign(signingInput string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(signingInput))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -2,90 +2,143 @@ package client
 
 import (
 	"context"
-	"deili-backend/config"
-	"log"
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/listing"
+	"regexp"
+	"strings"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// Client struct represents the client data structure
+// Client struct represents the client data structure as stored; the API serves it through
+// its own response types
 type Client struct {
-	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Name            string             `bson:"name" json:"name"`
-	Contact         string             `bson:"contact" json:"contact"`
-	InvitationTypes string             `bson:"invitation_types" json:"invitation_types"`
+	ID              primitive.ObjectID `bson:"_id,omitempty"`
+	Name            string             `bson:"name"`
+	Contact         string             `bson:"contact"`
+	InvitationTypes string             `bson:"invitation_types"`
+	// Slug names the couple's site, e.g. evelynandbenhard for evelynandbenhard.deiliinvitation.com;
+	// no two clients share one
+	Slug string `bson:"slug,omitempty"`
+	// Domains are custom domains serving the couple's site, managed apart from the other fields
+	Domains []Domain `bson:"domains,omitempty"`
+	// VerifiedHosts repeats the hosts of the verified Domains while the client is outside the
+	// trash; it is unique across clients, so only one of them serves a domain
+	VerifiedHosts []string `bson:"verified_hosts,omitempty"`
+
+	// CreatedAt and UpdatedAt are set by the store; clients stored before they existed have neither
+	CreatedAt time.Time `bson:"created_at,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at,omitempty"`
+	// Version counts the updates made to the client, see package revision
+	Version int64 `bson:"version"`
+
+	// DeletedAt is set while the client is in the trash
+	DeletedAt *time.Time `bson:"deleted_at,omitempty"`
 }
 
-var clientCollection *mongo.Collection
-
-// Init initializes the MongoDB connection for the client collection
-func Init() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// Use mongo.Connect() directly instead of deprecated mongo.NewClient()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		log.Fatal("Error connecting to MongoDB:", err)
-	}
-
-	clientCollection = client.Database(config.DBName).Collection("clients")
+// Patch holds the client fields a merge patch may change
+type Patch struct {
+	Name            string `json:"name"`
+	Contact         string `json:"contact"`
+	InvitationTypes string `json:"invitation_types"`
+	Slug            string `json:"slug"`
 }
 
-// CreateClient inserts a new client into the MongoDB client collection
-func CreateClient(client Client) (*mongo.InsertOneResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	return clientCollection.InsertOne(ctx, client)
+// Patch returns the patchable view of the client
+func (c Client) Patch() Patch {
+	return Patch{Name: c.Name, Contact: c.Contact, InvitationTypes: c.InvitationTypes, Slug: c.Slug}
 }
 
-// GetClients retrieves all clients from the MongoDB client collection
-func GetClients() ([]Client, error) {
-	var clients []Client
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// apply copies the patched fields onto c
+func (p Patch) apply(c *Client) {
+	c.Name = p.Name
+	c.Contact = p.Contact
+	c.InvitationTypes = p.InvitationTypes
+	c.Slug = p.Slug
+}
 
-	cursor, err := clientCollection.Find(ctx, bson.M{})
-	if err != nil {
-		return nil, err
+// validate checks the fields every stored client must satisfy
+func validate(c *Client) error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.InvitationTypes == "" {
+		return apperror.InvalidField("invitation_types", "cannot be empty")
 	}
-	if err = cursor.All(ctx, &clients); err != nil {
-		return nil, err
+	slug, err := NormalizeSlug(c.Slug)
+	if err != nil {
+		return err
 	}
-
-	return clients, nil
+	c.Slug = slug
+	return nil
 }
 
-// GetClientByID retrieves a client by its ObjectID
-func GetClientByID(id primitive.ObjectID) (*Client, error) {
-	var client Client
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	err := clientCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&client)
-	return &client, err
-}
+// slugPattern is a DNS label, since the slug is used as a subdomain
+var slugPattern = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{1,61}[a-z0-9])$`)
 
-// UpdateClient updates only the fields provided in the request body for a client
-func UpdateClient(id primitive.ObjectID, updatedData map[string]interface{}) (*mongo.UpdateResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// reservedSlugs are subdomains the platform uses itself
+var reservedSlugs = map[string]bool{"www": true, "api": true, "app": true, "admin": true, "mail": true, "static": true, "assets": true, "cdn": true}
 
-	filter := bson.M{"_id": id}
-	update := bson.M{
-		"$set": updatedData, // Dynamically set only the fields that are provided
+// NormalizeSlug lowercases a slug and checks it can serve as a subdomain; "" means no slug
+func NormalizeSlug(value string) (string, error) {
+	slug := strings.ToLower(strings.TrimSpace(value))
+	if slug == "" {
+		return "", nil
+	}
+	if !slugPattern.MatchString(slug) {
+		return "", apperror.InvalidField("slug", "must be 3 to 63 letters, digits or hyphens, and cannot start or end with a hyphen")
 	}
-	return clientCollection.UpdateOne(ctx, filter, update)
+	if reservedSlugs[slug] {
+		return "", apperror.InvalidField("slug", "%q is reserved", slug)
+	}
+	return slug, nil
 }
 
-// DeleteClient deletes a client from the collection based on its ObjectID
-func DeleteClient(id primitive.ObjectID) (*mongo.DeleteResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+var (
+	// ErrNotFound is returned when no client has the requested ID or slug
+	ErrNotFound = apperror.NotFound("client")
+	// ErrSlugTaken is returned when another client, possibly one in the trash, has the slug
+	ErrSlugTaken = apperror.Conflict("slug is already taken").WithField("slug", "is already taken")
+)
+
+// listKey returns the fields clients are sorted and paginated by
+func listKey(c Client) (string, primitive.ObjectID) {
+	return c.Name, c.ID
+}
 
-	return clientCollection.DeleteOne(ctx, bson.M{"_id": id})
+// ClientStore is the set of operations available on persisted clients
+type ClientStore interface {
+	CreateClient(ctx context.Context, client Client) (*mongo.InsertOneResult, error)
+	// ListClients returns one page of clients; q must be normalized
+	ListClients(ctx context.Context, q listing.Query) (*listing.Page[Client], error)
+	GetClientByID(ctx context.Context, id primitive.ObjectID) (*Client, error)
+	// GetClientBySlug returns the client with the slug, which must be normalized
+	GetClientBySlug(ctx context.Context, slug string) (*Client, error)
+	// GetClientByDomain returns the client with the verified custom domain
+	GetClientByDomain(ctx context.Context, host string) (*Client, error)
+	// UpdateClient writes the patchable fields of the client at version and returns the updated
+	// client; it returns revision.ErrConflict when the client has changed since
+	UpdateClient(ctx context.Context, id primitive.ObjectID, version int64, p Patch) (*Client, error)
+	// AddDomain registers a custom domain on a client and returns the updated client; it
+	// returns ErrDomainTaken when the client already has the host. Other clients may claim it
+	// too until one of them verifies it.
+	AddDomain(ctx context.Context, id primitive.ObjectID, d Domain) (*Client, error)
+	// SetDomainStatus records the outcome of checking a domain at checkedAt; it returns
+	// ErrDomainTaken when the domain is verified and another live client has it verified already
+	SetDomainStatus(ctx context.Context, id primitive.ObjectID, host string, status DomainStatus, checkedAt time.Time) (*Client, error)
+	// RemoveDomain drops a custom domain from a client, or returns ErrDomainNotFound
+	RemoveDomain(ctx context.Context, id primitive.ObjectID, host string) (*Client, error)
+	// ListVerifiedDomains returns the verified custom domains of the clients outside the trash
+	ListVerifiedDomains(ctx context.Context) ([]string, error)
+	// DeleteClient moves a client at version to the trash, stamping it with at; it returns
+	// revision.ErrConflict when the client has changed since
+	DeleteClient(ctx context.Context, id primitive.ObjectID, version int64, at time.Time) (*mongo.DeleteResult, error)
+
+	// Trash; clients in it are left out of every other operation
+	ListDeletedClients(ctx context.Context, q listing.Query) (*listing.Page[Client], error)
+	// RestoreClient takes a client out of the trash and returns it as it was in the trash, so
+	// callers can tell when it was deleted
+	RestoreClient(ctx context.Context, id primitive.ObjectID) (*Client, error)
+	// PurgeClients permanently deletes the clients trashed before cutoff and returns their IDs
+	PurgeClients(ctx context.Context, cutoff time.Time) ([]primitive.ObjectID, error)
 }
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/revision"
+	"encoding/hex"
+	"errors"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DomainStatus is where a custom domain stands in its ownership check
+type DomainStatus string
+
+const (
+	// DomainPending domains were added and not checked yet
+	DomainPending DomainStatus = "pending"
+	// DomainVerified domains proved to be the couple's and serve their site
+	DomainVerified DomainStatus = "verified"
+	// DomainFailed domains did not have the verification record at the last check
+	DomainFailed DomainStatus = "failed"
+)
+
+// MaxDomains is how many custom domains one client may register
+const MaxDomains = 5
+
+// verificationPrefix is prepended to a domain to name its verification TXT record
+const verificationPrefix = "_deili-verification."
+
+// Domain is a custom domain a couple serves their site from instead of a subdomain. Only
+// verified domains are trusted, since anyone can claim a name they do not own.
+type Domain struct {
+	Host   string       `bson:"host"`
+	Status DomainStatus `bson:"status"`
+	// VerificationToken is the value the TXT record named by VerificationRecord must hold
+	VerificationToken string     `bson:"verification_token"`
+	AddedAt           time.Time  `bson:"added_at"`
+	CheckedAt         *time.Time `bson:"checked_at,omitempty"`
+	VerifiedAt        *time.Time `bson:"verified_at,omitempty"`
+}
+
+var (
+	// ErrDomainNotFound is returned when the client has no such domain
+	ErrDomainNotFound = apperror.NotFound("domain")
+	// ErrDomainTaken is returned when the client already has the domain, or when another client
+	// has it verified
+	ErrDomainTaken = apperror.Conflict("domain is already registered").WithField("host", "is already registered")
+)
+
+// hostPattern is a fully qualified host name of at least two labels
+var hostPattern = regexp.MustCompile(`^(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// NormalizeHost lowercases a domain and checks it is a host name, without scheme or port
+func NormalizeHost(value string) (string, error) {
+	host := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), ".")
+	if host == "" {
+		return "", apperror.InvalidField("host", "is required")
+	}
+	if len(host) > 253 || !hostPattern.MatchString(host) {
+		return "", apperror.InvalidField("host", "must be a domain name such as evelynandbenhard.com, without scheme or port")
+	}
+	return host, nil
+}
+
+// NewDomain returns host as a pending domain with a fresh verification token
+func NewDomain(host string) (Domain, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return Domain{}, err
+	}
+	return Domain{Host: host, Status: DomainPending, VerificationToken: hex.EncodeToString(b), AddedAt: revision.Now()}, nil
+}
+
+// VerificationRecord names the TXT record that proves the couple controls the domain
+func (d Domain) VerificationRecord() string {
+	return verificationPrefix + d.Host
+}
+
+// Check looks up the verification record with lookupTXT, usually net.DefaultResolver.LookupTXT,
+// and reports whether it holds the token. A missing record is not an error.
+func (d Domain) Check(ctx context.Context, lookupTXT func(ctx context.Context, name string) ([]string, error)) (bool, error) {
+	records, err := lookupTXT(ctx, d.VerificationRecord())
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	return slices.Contains(records, d.VerificationToken), nil
+}
+
+// Domain returns the client's domain with the host
+func (c Client) Domain(host string) (Domain, bool) {
+	for _, d := range c.Domains {
+		if d.Host == host {
+			return d, true
+		}
+	}
+	return Domain{}, false
+}
+
+// verifiedHosts returns the hosts of the client's verified domains
+func (c Client) verifiedHosts() []string {
+	var hosts []string
+	for _, d := range c.Domains {
+		if d.Status == DomainVerified {
+			hosts = append(hosts, d.Host)
+		}
+	}
+	return hosts
+}
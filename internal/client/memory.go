@@ -0,0 +1,321 @@
+package client
+
+import (
+	"context"
+	"deili-backend/internal/listing"
+	"deili-backend/internal/revision"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MemoryStore is a thread-safe in-memory ClientStore, useful for tests and local development
+type MemoryStore struct {
+	mu      sync.RWMutex
+	clients map[primitive.ObjectID]Client
+	// trash holds deleted clients apart, so the other operations never see them
+	trash map[primitive.ObjectID]Client
+}
+
+var _ ClientStore = (*MemoryStore)(nil)
+
+// NewMemoryStore returns an empty in-memory client store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		clients: make(map[primitive.ObjectID]Client),
+		trash:   make(map[primitive.ObjectID]Client),
+	}
+}
+
+// CreateClient stores a new client, generating an ID when none is set
+func (s *MemoryStore) CreateClient(ctx context.Context, client Client) (*mongo.InsertOneResult, error) {
+	if err := validate(&client); err != nil {
+		return nil, err
+	}
+	client.DeletedAt = nil
+	client.CreatedAt = revision.Now()
+	client.UpdatedAt = client.CreatedAt
+	client.Version = 1
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if client.ID.IsZero() {
+		client.ID = primitive.NewObjectID()
+	}
+	_, exists := s.clients[client.ID]
+	if _, trashed := s.trash[client.ID]; exists || trashed {
+		return nil, mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: "duplicate key error"}}}
+	}
+	if s.slugTaken(client.Slug, client.ID) {
+		return nil, ErrSlugTaken
+	}
+	s.clients[client.ID] = client
+	return &mongo.InsertOneResult{InsertedID: client.ID}, nil
+}
+
+// ListClients returns one page of clients
+func (s *MemoryStore) ListClients(ctx context.Context, q listing.Query) (*listing.Page[Client], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return paginate(s.clients, q), nil
+}
+
+// ListDeletedClients returns one page of the clients in the trash
+func (s *MemoryStore) ListDeletedClients(ctx context.Context, q listing.Query) (*listing.Page[Client], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return paginate(s.trash, q), nil
+}
+
+// paginate returns one page of the clients in m
+func paginate(m map[primitive.ObjectID]Client, q listing.Query) *listing.Page[Client] {
+	clients := make([]Client, 0, len(m))
+	for _, c := range m {
+		clients = append(clients, c)
+	}
+	page := listing.Paginate(clients, q, listKey)
+	return &page
+}
+
+// slugTaken reports whether a client other than id, trashed or not, has the slug, like the
+// unique index in Mongo; s.mu must be held
+func (s *MemoryStore) slugTaken(slug string, id primitive.ObjectID) bool {
+	if slug == "" {
+		return false
+	}
+	for _, m := range []map[primitive.ObjectID]Client{s.clients, s.trash} {
+		for _, c := range m {
+			if c.Slug == slug && c.ID != id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetClientBySlug returns ErrNotFound when no client has the slug
+func (s *MemoryStore) GetClientBySlug(ctx context.Context, slug string) (*Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, c := range s.clients {
+		if c.Slug != "" && c.Slug == slug {
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// GetClientByDomain returns ErrNotFound when no client has the host as a verified domain
+func (s *MemoryStore) GetClientByDomain(ctx context.Context, host string) (*Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, c := range s.clients {
+		if slices.Contains(c.VerifiedHosts, host) {
+			return &c, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// AddDomain registers a custom domain on a client
+func (s *MemoryStore) AddDomain(ctx context.Context, id primitive.ObjectID, d Domain) (*Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.clients[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if _, taken := c.Domain(d.Host); taken {
+		return nil, ErrDomainTaken
+	}
+	c.Domains = append(slices.Clone(c.Domains), d)
+	return s.touch(c), nil
+}
+
+// SetDomainStatus records the outcome of checking a domain
+func (s *MemoryStore) SetDomainStatus(ctx context.Context, id primitive.ObjectID, host string, status DomainStatus, checkedAt time.Time) (*Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.clients[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	i := slices.IndexFunc(c.Domains, func(d Domain) bool { return d.Host == host })
+	if i < 0 {
+		return nil, ErrDomainNotFound
+	}
+	if status == DomainVerified && s.verifiedElsewhere(id, host) {
+		return nil, ErrDomainTaken
+	}
+	c.Domains = slices.Clone(c.Domains)
+	c.Domains[i].Status = status
+	c.Domains[i].CheckedAt = &checkedAt
+	if status == DomainVerified {
+		c.Domains[i].VerifiedAt = &checkedAt
+	}
+	c.VerifiedHosts = c.verifiedHosts()
+	return s.touch(c), nil
+}
+
+// RemoveDomain removes a custom domain from a client
+func (s *MemoryStore) RemoveDomain(ctx context.Context, id primitive.ObjectID, host string) (*Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.clients[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if _, ok := c.Domain(host); !ok {
+		return nil, ErrDomainNotFound
+	}
+	c.Domains = slices.DeleteFunc(slices.Clone(c.Domains), func(d Domain) bool { return d.Host == host })
+	c.VerifiedHosts = c.verifiedHosts()
+	return s.touch(c), nil
+}
+
+// verifiedElsewhere reports whether a live client other than id has host verified; s.mu must be
+// held
+func (s *MemoryStore) verifiedElsewhere(id primitive.ObjectID, host string) bool {
+	for _, c := range s.clients {
+		if c.ID != id && slices.Contains(c.VerifiedHosts, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// touch stores c as changed now and returns the stored copy; s.mu must be held
+func (s *MemoryStore) touch(c Client) *Client {
+	c.UpdatedAt = revision.Now()
+	c.Version++
+	s.clients[c.ID] = c
+	return &c
+}
+
+// ListVerifiedDomains returns the verified domains of the clients outside the trash
+func (s *MemoryStore) ListVerifiedDomains(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var hosts []string
+	for _, c := range s.clients {
+		for _, d := range c.Domains {
+			if d.Status == DomainVerified {
+				hosts = append(hosts, d.Host)
+			}
+		}
+	}
+	return hosts, nil
+}
+
+// GetClientByID returns ErrNotFound when the client does not exist, like the Mongo store
+func (s *MemoryStore) GetClientByID(ctx context.Context, id primitive.ObjectID) (*Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	client, ok := s.clients[id]
+	if !ok {
+		return &Client{}, ErrNotFound
+	}
+	return &client, nil
+}
+
+// UpdateClient sets the patchable fields of a client at version and returns the updated copy
+func (s *MemoryStore) UpdateClient(ctx context.Context, id primitive.ObjectID, version int64, p Patch) (*Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.clients[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if existing.Version != version {
+		return nil, revision.ErrConflict
+	}
+	updated := existing
+	p.apply(&updated)
+	if err := validate(&updated); err != nil {
+		return nil, err
+	}
+	if s.slugTaken(updated.Slug, id) {
+		return nil, ErrSlugTaken
+	}
+	updated.UpdatedAt = revision.Now()
+	updated.Version++
+	s.clients[id] = updated
+	return &updated, nil
+}
+
+// DeleteClient moves a client at version to the trash
+func (s *MemoryStore) DeleteClient(ctx context.Context, id primitive.ObjectID, version int64, at time.Time) (*mongo.DeleteResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, ok := s.clients[id]
+	if !ok {
+		return &mongo.DeleteResult{}, nil
+	}
+	if client.Version != version {
+		return nil, revision.ErrConflict
+	}
+	client.DeletedAt = &at
+	client.UpdatedAt = at
+	client.Version++
+	client.VerifiedHosts = nil
+	s.trash[id] = client
+	delete(s.clients, id)
+	return &mongo.DeleteResult{DeletedCount: 1}, nil
+}
+
+// RestoreClient moves a client back out of the trash, counting it as an update, and returns it
+// as it was in the trash apart from that and the domains another client verified meanwhile,
+// which are marked failed
+func (s *MemoryStore) RestoreClient(ctx context.Context, id primitive.ObjectID) (*Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trashed, ok := s.trash[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	trashed.Domains = slices.Clone(trashed.Domains)
+	for i, d := range trashed.Domains {
+		if d.Status == DomainVerified && s.verifiedElsewhere(id, d.Host) {
+			trashed.Domains[i].Status = DomainFailed
+		}
+	}
+	trashed.VerifiedHosts = trashed.verifiedHosts()
+	trashed.UpdatedAt = revision.Now()
+	trashed.Version++
+	restored := trashed
+	restored.DeletedAt = nil
+	s.clients[id] = restored
+	delete(s.trash, id)
+	return &trashed, nil
+}
+
+// PurgeClients permanently deletes the clients trashed before cutoff
+func (s *MemoryStore) PurgeClients(ctx context.Context, cutoff time.Time) ([]primitive.ObjectID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []primitive.ObjectID
+	for id, c := range s.trash {
+		if c.DeletedAt.Before(cutoff) {
+			delete(s.trash, id)
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
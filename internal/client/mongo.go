@@ -0,0 +1,402 @@
+package client
+
+import (
+	"context"
+	"deili-backend/internal/listing"
+	"deili-backend/internal/revision"
+	"deili-backend/internal/trash"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore is a ClientStore backed by the MongoDB client collection
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+var _ ClientStore = (*MongoStore)(nil)
+
+// NewMongoStore returns a store using the clients collection of the given database
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{collection: db.Collection("clients")}
+}
+
+// CreateClient inserts a new client into the MongoDB client collection
+func (s *MongoStore) CreateClient(ctx context.Context, client Client) (*mongo.InsertOneResult, error) {
+	if err := validate(&client); err != nil {
+		return nil, err
+	}
+	client.DeletedAt = nil
+	client.CreatedAt = revision.Now()
+	client.UpdatedAt = client.CreatedAt
+	client.Version = 1
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	result, err := s.collection.InsertOne(ctx, client)
+	if isSlugConflict(err) {
+		return nil, ErrSlugTaken
+	}
+	return result, err
+}
+
+// isSlugConflict reports whether err is a write refused by the unique slug index
+func isSlugConflict(err error) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "slug")
+}
+
+// ListClients retrieves one page of clients from the MongoDB client collection
+func (s *MongoStore) ListClients(ctx context.Context, q listing.Query) (*listing.Page[Client], error) {
+	return s.list(ctx, trash.Live(bson.M{}), q)
+}
+
+// ListDeletedClients retrieves one page of the clients in the trash
+func (s *MongoStore) ListDeletedClients(ctx context.Context, q listing.Query) (*listing.Page[Client], error) {
+	return s.list(ctx, trash.Only(bson.M{}), q)
+}
+
+// list retrieves one page of the clients matching base
+func (s *MongoStore) list(ctx context.Context, base bson.M, q listing.Query) (*listing.Page[Client], error) {
+	var clients []Client
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	total, err := s.collection.CountDocuments(ctx, q.CountFilter(base), q.CountOptions())
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := s.collection.Find(ctx, q.MongoFilter(base), q.FindOptions())
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &clients); err != nil {
+		return nil, err
+	}
+
+	page := listing.NewPage(clients, total, q, listKey)
+	return &page, nil
+}
+
+// GetClientByID retrieves a client by its ObjectID
+func (s *MongoStore) GetClientByID(ctx context.Context, id primitive.ObjectID) (*Client, error) {
+	var client Client
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := s.collection.FindOne(ctx, trash.Live(bson.M{"_id": id})).Decode(&client)
+	if err == mongo.ErrNoDocuments {
+		return &client, ErrNotFound
+	}
+	return &client, err
+}
+
+// GetClientBySlug retrieves the client with the slug
+func (s *MongoStore) GetClientBySlug(ctx context.Context, slug string) (*Client, error) {
+	if slug == "" {
+		return nil, ErrNotFound
+	}
+	var client Client
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := s.collection.FindOne(ctx, trash.Live(bson.M{"slug": slug})).Decode(&client)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// GetClientByDomain retrieves the client with the verified custom domain
+func (s *MongoStore) GetClientByDomain(ctx context.Context, host string) (*Client, error) {
+	var client Client
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := s.collection.FindOne(ctx, trash.Live(bson.M{"verified_hosts": host})).Decode(&client)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// AddDomain pushes a custom domain onto a client. Other clients may have claimed the same host;
+// SetDomainStatus settles which one serves it.
+func (s *MongoStore) AddDomain(ctx context.Context, id primitive.ObjectID, d Domain) (*Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := trash.Live(bson.M{"_id": id, "domains.host": bson.M{"$ne": d.Host}})
+	update := revision.Bump(bson.M{"$push": bson.M{"domains": d}, "$set": bson.M{"updated_at": revision.Now()}})
+	client, err := s.updateDomains(ctx, filter, update)
+	if err == mongo.ErrNoDocuments {
+		// Either the client is gone or it has the domain already
+		if _, err := s.GetClientByID(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrDomainTaken
+	}
+	return client, err
+}
+
+// SetDomainStatus records the outcome of checking a domain; the unique index on verified_hosts
+// keeps two clients from verifying the same one
+func (s *MongoStore) SetDomainStatus(ctx context.Context, id primitive.ObjectID, host string, status DomainStatus, checkedAt time.Time) (*Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	set := bson.M{"domains.$.status": status, "domains.$.checked_at": checkedAt, "updated_at": revision.Now()}
+	update := bson.M{"$set": set, "$pull": bson.M{"verified_hosts": host}}
+	if status == DomainVerified {
+		set["domains.$.verified_at"] = checkedAt
+		update = bson.M{"$set": set, "$addToSet": bson.M{"verified_hosts": host}}
+	}
+	client, err := s.updateDomains(ctx, trash.Live(bson.M{"_id": id, "domains.host": host}), revision.Bump(update))
+	if mongo.IsDuplicateKeyError(err) {
+		return nil, ErrDomainTaken
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, s.missingDomain(ctx, id)
+	}
+	return client, err
+}
+
+// RemoveDomain pulls a custom domain off a client
+func (s *MongoStore) RemoveDomain(ctx context.Context, id primitive.ObjectID, host string) (*Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	update := revision.Bump(bson.M{"$pull": bson.M{"domains": bson.M{"host": host}, "verified_hosts": host}, "$set": bson.M{"updated_at": revision.Now()}})
+	client, err := s.updateDomains(ctx, trash.Live(bson.M{"_id": id, "domains.host": host}), update)
+	if err == mongo.ErrNoDocuments {
+		return nil, s.missingDomain(ctx, id)
+	}
+	return client, err
+}
+
+// updateDomains applies update to the client matching filter and returns the updated document
+func (s *MongoStore) updateDomains(ctx context.Context, filter, update bson.M) (*Client, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var client Client
+	if err := s.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&client); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// missingDomain tells whether a domain update matched nothing because the client or the
+// domain does not exist
+func (s *MongoStore) missingDomain(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := s.GetClientByID(ctx, id); err != nil {
+		return err
+	}
+	return ErrDomainNotFound
+}
+
+// ListVerifiedDomains returns the verified domains of the clients outside the trash
+func (s *MongoStore) ListVerifiedDomains(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	verified := bson.M{"domains.status": DomainVerified}
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: trash.Live(bson.M{"domains": bson.M{"$elemMatch": bson.M{"status": DomainVerified}}})}},
+		{{Key: "$unwind", Value: "$domains"}},
+		{{Key: "$match", Value: verified}},
+		{{Key: "$project", Value: bson.M{"_id": 0, "host": "$domains.host"}}},
+	}
+	cursor, err := s.collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		Host string `bson:"host"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	hosts := make([]string, len(docs))
+	for i, doc := range docs {
+		hosts[i] = doc.Host
+	}
+	return hosts, nil
+}
+
+// UpdateClient sets the patchable fields of a client at version and returns the updated document
+func (s *MongoStore) UpdateClient(ctx context.Context, id primitive.ObjectID, version int64, p Patch) (*Client, error) {
+	var updated Client
+	p.apply(&updated)
+	if err := validate(&updated); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	update := bson.M{"$set": bson.M{
+		"name":             updated.Name,
+		"contact":          updated.Contact,
+		"invitation_types": updated.InvitationTypes,
+		"updated_at":       revision.Now(),
+	}}
+	// The unique slug index skips clients without one, so a cleared slug is removed entirely
+	if updated.Slug == "" {
+		update["$unset"] = bson.M{"slug": ""}
+	} else {
+		update["$set"].(bson.M)["slug"] = updated.Slug
+	}
+	revision.Bump(update)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var client Client
+	err := s.collection.FindOneAndUpdate(ctx, revision.Match(trash.Live(bson.M{"_id": id}), version), update, opts).Decode(&client)
+	if isSlugConflict(err) {
+		return nil, ErrSlugTaken
+	}
+	if err == mongo.ErrNoDocuments {
+		// Either the client is gone or another update got there first
+		count, err := s.collection.CountDocuments(ctx, trash.Live(bson.M{"_id": id}))
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, revision.ErrConflict
+		}
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// DeleteClient moves a client at version to the trash by setting its deleted_at
+func (s *MongoStore) DeleteClient(ctx context.Context, id primitive.ObjectID, version int64, at time.Time) (*mongo.DeleteResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	// A trashed client does not serve its domains, so it gives up its claim on them
+	update := revision.Bump(bson.M{"$set": bson.M{trash.Field: at, "updated_at": at}, "$unset": bson.M{"verified_hosts": ""}})
+	result, err := s.collection.UpdateOne(ctx, revision.Match(trash.Live(bson.M{"_id": id}), version), update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		// Either the client is gone or another update got there first
+		count, err := s.collection.CountDocuments(ctx, trash.Live(bson.M{"_id": id}))
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, revision.ErrConflict
+		}
+	}
+	return &mongo.DeleteResult{DeletedCount: result.ModifiedCount}, nil
+}
+
+// RestoreClient unsets deleted_at and returns the client as it was in the trash, apart from the
+// version and updated_at the restore gave it and the domains it could not reclaim
+func (s *MongoStore) RestoreClient(ctx context.Context, id primitive.ObjectID) (*Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := revision.Now()
+	update := revision.Bump(bson.M{"$unset": bson.M{trash.Field: ""}, "$set": bson.M{"updated_at": now}})
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	var client Client
+	err := s.collection.FindOneAndUpdate(ctx, trash.Only(bson.M{"_id": id}), update, opts).Decode(&client)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	client.Version++
+	client.UpdatedAt = now
+	if err := s.reclaimDomains(ctx, &client); err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// reclaimDomains lists the verified domains of a client taken out of the trash in
+// verified_hosts again. A domain another client verified meanwhile is marked failed instead,
+// and c is updated to match.
+func (s *MongoStore) reclaimDomains(ctx context.Context, c *Client) error {
+	verified := c.verifiedHosts()
+	if len(verified) == 0 {
+		return nil
+	}
+	// Checked up front rather than left to the unique index, since a duplicate key error
+	// aborts the transaction the restore runs in
+	filter := trash.Live(bson.M{"_id": bson.M{"$ne": c.ID}, "verified_hosts": bson.M{"$in": verified}})
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"verified_hosts": 1}))
+	if err != nil {
+		return err
+	}
+	var others []Client
+	if err := cursor.All(ctx, &others); err != nil {
+		return err
+	}
+
+	c.Domains = slices.Clone(c.Domains)
+	for i, d := range c.Domains {
+		if d.Status != DomainVerified {
+			continue
+		}
+		for _, other := range others {
+			if slices.Contains(other.VerifiedHosts, d.Host) {
+				c.Domains[i].Status = DomainFailed
+			}
+		}
+	}
+	c.VerifiedHosts = c.verifiedHosts()
+
+	set := bson.M{"domains": c.Domains}
+	if len(c.VerifiedHosts) > 0 {
+		set["verified_hosts"] = c.VerifiedHosts
+	}
+	_, err = s.collection.UpdateOne(ctx, bson.M{"_id": c.ID}, bson.M{"$set": set})
+	return err
+}
+
+// PurgeClients permanently deletes the clients trashed before cutoff
+func (s *MongoStore) PurgeClients(ctx context.Context, cutoff time.Time) ([]primitive.ObjectID, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	filter := trash.DeletedBefore(bson.M{}, cutoff)
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	// Only the listed clients are deleted, so the returned IDs match what was removed
+	if _, err := s.collection.DeleteMany(ctx, trash.DeletedBefore(bson.M{"_id": bson.M{"$in": ids}}, cutoff)); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
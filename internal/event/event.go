@@ -0,0 +1,133 @@
+package event
+
+import (
+	"context"
+	"deili-backend/internal/apperror"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Event is one part of a client's celebration, e.g. the akad, the reception or the after-party.
+// The API serves it through its own response types.
+type Event struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	ClientID  primitive.ObjectID `bson:"client_id"`
+	Name      string             `bson:"name"`
+	StartsAt  time.Time          `bson:"starts_at"`
+	EndsAt    time.Time          `bson:"ends_at"`
+	TimeZone  string             `bson:"time_zone"`
+	Venue     Venue              `bson:"venue"`
+	DressCode string             `bson:"dress_code,omitempty"`
+	Capacity  int                `bson:"capacity,omitempty"`
+	// SeatsTaken counts the people attending, plus-ones included. Only TakeSeats and AddSeats
+	// change it, so the capacity check and the count move together.
+	SeatsTaken int `bson:"seats_taken,omitempty"`
+
+	// CreatedAt and UpdatedAt are set by the store; events stored before they existed have neither
+	CreatedAt time.Time `bson:"created_at,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at,omitempty"`
+	// Version counts the updates made to the event, see package revision
+	Version int64 `bson:"version"`
+}
+
+// Venue is where an event takes place
+type Venue struct {
+	Name        string       `bson:"name" json:"name"`
+	Address     string       `bson:"address" json:"address"`
+	Coordinates *Coordinates `bson:"coordinates,omitempty" json:"coordinates,omitempty"`
+}
+
+// Coordinates locate a venue on the map
+type Coordinates struct {
+	Latitude  float64 `bson:"latitude" json:"latitude"`
+	Longitude float64 `bson:"longitude" json:"longitude"`
+}
+
+// EventStore is the set of operations available on persisted events
+type EventStore interface {
+	CreateEvent(ctx context.Context, event Event) (*mongo.InsertOneResult, error)
+	GetEventsByClient(ctx context.Context, clientID primitive.ObjectID) ([]Event, error)
+	GetEventByID(ctx context.Context, id primitive.ObjectID) (*Event, error)
+	// UpdateEvent replaces the details of the event at updatedData.Version; it returns
+	// revision.ErrConflict when the event has changed since
+	UpdateEvent(ctx context.Context, id primitive.ObjectID, updatedData Event) (*mongo.UpdateResult, error)
+	// DeleteEvent removes the event at version; it returns revision.ErrConflict when the event
+	// has changed since
+	DeleteEvent(ctx context.Context, id primitive.ObjectID, version int64) (*mongo.DeleteResult, error)
+	// DeleteEventsByClient removes every event of a client, used when the client is deleted
+	DeleteEventsByClient(ctx context.Context, clientID primitive.ObjectID) (*mongo.DeleteResult, error)
+	// TakeSeats adds n seats to the event's SeatsTaken in one conditional write, and returns
+	// ErrFull instead when the event has a capacity and fewer than n seats left
+	TakeSeats(ctx context.Context, id primitive.ObjectID, n int) error
+	// AddSeats adds n, possibly negative, to the event's SeatsTaken without checking its
+	// capacity, for seats given back or returned to a restored guest
+	AddSeats(ctx context.Context, id primitive.ObjectID, n int) error
+}
+
+// ErrNotFound is returned when no event has the requested ID
+var ErrNotFound = apperror.NotFound("event")
+
+// ErrFull is returned when an event does not have the seats an RSVP asks for
+var ErrFull = apperror.Conflict("the event is full")
+
+// ErrInvalidEvent is wrapped by every event validation failure
+var ErrInvalidEvent = errors.New("invalid event")
+
+// invalidEvent reports a problem with one event field as a validation error wrapping ErrInvalidEvent
+func invalidEvent(field, format string, args ...any) error {
+	problem := fmt.Sprintf(format, args...)
+	return apperror.Validation("%v: %s", ErrInvalidEvent, problem).WithField(field, problem).Wrap(ErrInvalidEvent)
+}
+
+// Location returns the event's time zone for displaying its start and end times
+func (e Event) Location() *time.Location {
+	loc, err := time.LoadLocation(e.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// validate checks the fields every stored event must satisfy and trims free-text input
+func validate(e *Event) error {
+	e.Name = strings.TrimSpace(e.Name)
+	if e.Name == "" {
+		return invalidEvent("name", "name cannot be empty")
+	}
+	if e.ClientID.IsZero() {
+		return invalidEvent("client_id", "client_id is zero")
+	}
+	if e.StartsAt.IsZero() {
+		return invalidEvent("starts_at", "starts_at is required")
+	}
+	if e.EndsAt.IsZero() {
+		return invalidEvent("ends_at", "ends_at is required")
+	}
+	if !e.EndsAt.After(e.StartsAt) {
+		return invalidEvent("ends_at", "ends_at must be after starts_at")
+	}
+	if e.TimeZone == "" {
+		return invalidEvent("time_zone", "time_zone is required")
+	}
+	if _, err := time.LoadLocation(e.TimeZone); err != nil {
+		return invalidEvent("time_zone", "unknown time_zone %q", e.TimeZone)
+	}
+	if e.Capacity < 0 {
+		return invalidEvent("capacity", "capacity cannot be negative")
+	}
+	if c := e.Venue.Coordinates; c != nil {
+		if c.Latitude < -90 || c.Latitude > 90 || c.Longitude < -180 || c.Longitude > 180 {
+			return invalidEvent("venue.coordinates", "coordinates are out of range")
+		}
+	}
+
+	// Store instants in UTC; the time zone is kept separately for display
+	e.StartsAt = e.StartsAt.UTC()
+	e.EndsAt = e.EndsAt.UTC()
+	return nil
+}
@@ -0,0 +1,159 @@
+package event
+
+import (
+	"context"
+	"deili-backend/internal/revision"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MemoryStore is a thread-safe in-memory EventStore, useful for tests and local development
+type MemoryStore struct {
+	mu     sync.RWMutex
+	events map[primitive.ObjectID]Event
+}
+
+var _ EventStore = (*MemoryStore)(nil)
+
+// NewMemoryStore returns an empty in-memory event store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{events: make(map[primitive.ObjectID]Event)}
+}
+
+// CreateEvent stores a new event after validating it
+func (s *MemoryStore) CreateEvent(ctx context.Context, event Event) (*mongo.InsertOneResult, error) {
+	if err := validate(&event); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if event.ID.IsZero() {
+		event.ID = primitive.NewObjectID()
+	}
+	event.CreatedAt = revision.Now()
+	event.UpdatedAt = event.CreatedAt
+	event.Version = 1
+	s.events[event.ID] = event
+	return &mongo.InsertOneResult{InsertedID: event.ID}, nil
+}
+
+// GetEventsByClient returns a client's events in chronological order
+func (s *MemoryStore) GetEventsByClient(ctx context.Context, clientID primitive.ObjectID) ([]Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []Event
+	for _, e := range s.events {
+		if e.ClientID == clientID {
+			events = append(events, e)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].StartsAt.Before(events[j].StartsAt)
+	})
+	return events, nil
+}
+
+// GetEventByID returns ErrNotFound when the event does not exist, like the Mongo store
+func (s *MemoryStore) GetEventByID(ctx context.Context, id primitive.ObjectID) (*Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	event, ok := s.events[id]
+	if !ok {
+		return &Event{}, ErrNotFound
+	}
+	return &event, nil
+}
+
+// UpdateEvent replaces an event's details; the owning client cannot change
+func (s *MemoryStore) UpdateEvent(ctx context.Context, id primitive.ObjectID, updatedData Event) (*mongo.UpdateResult, error) {
+	if err := validate(&updatedData); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.events[id]
+	if !ok || existing.ClientID != updatedData.ClientID {
+		return &mongo.UpdateResult{}, nil
+	}
+	if existing.Version != updatedData.Version {
+		return nil, revision.ErrConflict
+	}
+	updatedData.ID = id
+	updatedData.SeatsTaken = existing.SeatsTaken
+	updatedData.CreatedAt = existing.CreatedAt
+	updatedData.UpdatedAt = revision.Now()
+	updatedData.Version++
+	s.events[id] = updatedData
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+// DeleteEvent removes the event at version
+func (s *MemoryStore) DeleteEvent(ctx context.Context, id primitive.ObjectID, version int64) (*mongo.DeleteResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.events[id]
+	if !ok {
+		return &mongo.DeleteResult{}, nil
+	}
+	if existing.Version != version {
+		return nil, revision.ErrConflict
+	}
+	delete(s.events, id)
+	return &mongo.DeleteResult{DeletedCount: 1}, nil
+}
+
+// TakeSeats checks the capacity and takes the seats under one lock
+func (s *MemoryStore) TakeSeats(ctx context.Context, id primitive.ObjectID, n int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.events[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if e.Capacity > 0 && e.SeatsTaken+n > e.Capacity {
+		return ErrFull
+	}
+	e.SeatsTaken += n
+	s.events[id] = e
+	return nil
+}
+
+// AddSeats changes the seats taken whatever the capacity
+func (s *MemoryStore) AddSeats(ctx context.Context, id primitive.ObjectID, n int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.events[id]
+	if !ok {
+		return ErrNotFound
+	}
+	e.SeatsTaken += n
+	s.events[id] = e
+	return nil
+}
+
+// DeleteEventsByClient removes every event of a client
+func (s *MemoryStore) DeleteEventsByClient(ctx context.Context, clientID primitive.ObjectID) (*mongo.DeleteResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &mongo.DeleteResult{}
+	for id, e := range s.events {
+		if e.ClientID == clientID {
+			delete(s.events, id)
+			result.DeletedCount++
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,177 @@
+package event
+
+import (
+	"context"
+	"deili-backend/internal/revision"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore is an EventStore backed by the MongoDB events collection
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+var _ EventStore = (*MongoStore)(nil)
+
+// NewMongoStore returns a store using the events collection of the given database
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{collection: db.Collection("events")}
+}
+
+// CreateEvent inserts a new event after validating it
+func (s *MongoStore) CreateEvent(ctx context.Context, event Event) (*mongo.InsertOneResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := validate(&event); err != nil {
+		return nil, err
+	}
+	event.CreatedAt = revision.Now()
+	event.UpdatedAt = event.CreatedAt
+	event.Version = 1
+	return s.collection.InsertOne(ctx, event)
+}
+
+// GetEventsByClient retrieves a client's events in chronological order
+func (s *MongoStore) GetEventsByClient(ctx context.Context, clientID primitive.ObjectID) ([]Event, error) {
+	var events []Event
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "starts_at", Value: 1}})
+	cursor, err := s.collection.Find(ctx, bson.M{"client_id": clientID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// GetEventByID retrieves an event by its ObjectID
+func (s *MongoStore) GetEventByID(ctx context.Context, id primitive.ObjectID) (*Event, error) {
+	var event Event
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := s.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&event)
+	if err == mongo.ErrNoDocuments {
+		return &event, ErrNotFound
+	}
+	return &event, err
+}
+
+// UpdateEvent replaces an event's details; the owning client cannot change
+func (s *MongoStore) UpdateEvent(ctx context.Context, id primitive.ObjectID, updatedData Event) (*mongo.UpdateResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := validate(&updatedData); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"_id": id, "client_id": updatedData.ClientID}
+	update := revision.Bump(bson.M{
+		"$set": bson.M{
+			"name":       updatedData.Name,
+			"starts_at":  updatedData.StartsAt,
+			"ends_at":    updatedData.EndsAt,
+			"time_zone":  updatedData.TimeZone,
+			"venue":      updatedData.Venue,
+			"dress_code": updatedData.DressCode,
+			"capacity":   updatedData.Capacity,
+			"updated_at": revision.Now(),
+		},
+	})
+	result, err := s.collection.UpdateOne(ctx, revision.Match(bson.M{"_id": id, "client_id": updatedData.ClientID}, updatedData.Version), update)
+	if err != nil || result.MatchedCount > 0 {
+		return result, err
+	}
+	// Either the event is gone or another update got there first
+	count, err := s.collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, revision.ErrConflict
+	}
+	return result, nil
+}
+
+// DeleteEvent deletes the event at version from the collection
+func (s *MongoStore) DeleteEvent(ctx context.Context, id primitive.ObjectID, version int64) (*mongo.DeleteResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := s.collection.DeleteOne(ctx, revision.Match(bson.M{"_id": id}, version))
+	if err != nil || result.DeletedCount > 0 {
+		return result, err
+	}
+	// Either the event is gone or another update got there first
+	count, err := s.collection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, revision.ErrConflict
+	}
+	return result, nil
+}
+
+// TakeSeats increments seats_taken only where the result stays within the capacity, so two
+// guests cannot both take the last seats. The version is left alone, since answering an RSVP
+// does not change the event.
+func (s *MongoStore) TakeSeats(ctx context.Context, id primitive.ObjectID, n int) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	filter := bson.M{"_id": id, "$or": bson.A{
+		bson.M{"capacity": bson.M{"$in": bson.A{0, nil}}},
+		bson.M{"$expr": bson.M{"$lte": bson.A{bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$seats_taken", 0}}, n}}, "$capacity"}}},
+	}}
+	result, err := s.collection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"seats_taken": n}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+	count, err := s.collection.CountDocuments(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return ErrFull
+}
+
+// AddSeats increments seats_taken whatever the capacity
+func (s *MongoStore) AddSeats(ctx context.Context, id primitive.ObjectID, n int) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$inc": bson.M{"seats_taken": n}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteEventsByClient deletes every event of a client
+func (s *MongoStore) DeleteEventsByClient(ctx context.Context, clientID primitive.ObjectID) (*mongo.DeleteResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return s.collection.DeleteMany(ctx, bson.M{"client_id": clientID})
+}
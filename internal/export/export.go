@@ -0,0 +1,114 @@
+// Package export writes tabular data as CSV or XLSX one row at a time, so large
+// guest lists can be streamed straight from a database cursor to the response.
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format is a supported spreadsheet format
+type Format string
+
+const (
+	FormatCSV  Format = "csv"
+	FormatXLSX Format = "xlsx"
+)
+
+// ParseFormat accepts "csv" or "xlsx"; an empty value means CSV
+func ParseFormat(value string) (Format, error) {
+	switch Format(strings.ToLower(value)) {
+	case "", FormatCSV:
+		return FormatCSV, nil
+	case FormatXLSX:
+		return FormatXLSX, nil
+	}
+	return "", fmt.Errorf("unsupported export format %q, use csv or xlsx", value)
+}
+
+// ContentType is the MIME type to send for the format
+func (f Format) ContentType() string {
+	if f == FormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Column describes one exported column; Numeric columns are written as numbers in XLSX
+type Column struct {
+	Header  string
+	Numeric bool
+}
+
+// RowWriter writes rows after the header; Close must be called to finish the file
+type RowWriter interface {
+	Write(row []string) error
+	Close() error
+}
+
+// NewWriter returns a RowWriter for the format that has already written the header row
+func NewWriter(f Format, w io.Writer, sheetName string, columns []Column) (RowWriter, error) {
+	if f == FormatXLSX {
+		return newXLSXWriter(w, sheetName, columns)
+	}
+	return newCSVWriter(w, columns)
+}
+
+// utf8BOM makes Excel open the CSV as UTF-8 so non-Latin names are not garbled
+const utf8BOM = "\xEF\xBB\xBF"
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer, columns []Column) (*csvWriter, error) {
+	if _, err := io.WriteString(w, utf8BOM); err != nil {
+		return nil, err
+	}
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.Header
+	}
+	if err := cw.Write(header); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (c *csvWriter) Write(row []string) error {
+	escaped := make([]string, len(row))
+	for i, v := range row {
+		escaped[i] = neutralizeFormula(v)
+	}
+	if err := c.w.Write(escaped); err != nil {
+		return err
+	}
+	// Flush per row so the response streams instead of buffering in the csv.Writer
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// neutralizeFormula stops spreadsheet apps from evaluating guest-supplied text as a formula.
+// Values like "+62 812-3456" are left alone since they can only evaluate to a number.
+func neutralizeFormula(v string) string {
+	if v == "" {
+		return v
+	}
+	switch v[0] {
+	case '=', '@', '\t', '\r':
+		return "'" + v
+	case '+', '-':
+		if strings.Trim(v[1:], "0123456789 .-()") != "" {
+			return "'" + v
+		}
+	}
+	return v
+}
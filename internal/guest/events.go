@@ -0,0 +1,98 @@
+package guest
+
+import (
+	"deili-backend/internal/revision"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventRSVP is a guest's answer for one of the client's events
+type EventRSVP struct {
+	EventID      primitive.ObjectID `bson:"event_id" json:"event_id"`
+	Confirmation ConfirmationStatus `bson:"confirmation" json:"confirmation"`
+	PartySize    int                `bson:"party_size" json:"party_size"`
+	RespondedAt  time.Time          `bson:"responded_at" json:"responded_at"`
+}
+
+// Seats returns how many seats the answer holds at its event: the party when attending, and
+// none otherwise
+func (r EventRSVP) Seats() int {
+	if r.Confirmation != StatusAttending {
+		return 0
+	}
+	return r.PartySize
+}
+
+// IsInvitedTo reports whether the guest may RSVP for the event
+func (g Guest) IsInvitedTo(eventID primitive.ObjectID) bool {
+	if len(g.InvitedEventIDs) == 0 {
+		return true
+	}
+	for _, id := range g.InvitedEventIDs {
+		if id == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+// EventRSVP returns the guest's answer for the event, if any
+func (g Guest) EventRSVP(eventID primitive.ObjectID) (EventRSVP, bool) {
+	for _, rsvp := range g.EventRSVPs {
+		if rsvp.EventID == eventID {
+			return rsvp, true
+		}
+	}
+	return EventRSVP{}, false
+}
+
+// NormalizeEventRSVP applies the same status and party size rules as the guest-level RSVP
+func NormalizeEventRSVP(existing Guest, rsvp *EventRSVP) error {
+	if rsvp.EventID.IsZero() {
+		return invalidRSVP("event_id", "event_id is zero")
+	}
+	if !existing.IsInvitedTo(rsvp.EventID) {
+		return invalidRSVP("event_id", "guest is not invited to event %s", rsvp.EventID.Hex())
+	}
+
+	g := Guest{Confirmation: rsvp.Confirmation, PartySize: rsvp.PartySize}
+	if err := normalizeRSVP(&g, existing.EffectiveMaxPartySize()); err != nil {
+		return err
+	}
+	rsvp.Confirmation = g.Confirmation
+	rsvp.PartySize = g.PartySize
+	if rsvp.RespondedAt.IsZero() {
+		rsvp.RespondedAt = revision.Now()
+	}
+	return nil
+}
+
+// keepInvitedRSVPs drops answers for events the guest is no longer invited to
+func keepInvitedRSVPs(g Guest) []EventRSVP {
+	var kept []EventRSVP
+	for _, rsvp := range g.EventRSVPs {
+		if g.IsInvitedTo(rsvp.EventID) {
+			kept = append(kept, rsvp)
+		}
+	}
+	return kept
+}
+
+// withEventRSVP returns a copy of rsvps with the answer for rsvp's event replaced in place, or
+// appended when there is none
+func withEventRSVP(rsvps []EventRSVP, rsvp EventRSVP) []EventRSVP {
+	updated := make([]EventRSVP, 0, len(rsvps)+1)
+	replaced := false
+	for _, r := range rsvps {
+		if r.EventID == rsvp.EventID {
+			r = rsvp
+			replaced = true
+		}
+		updated = append(updated, r)
+	}
+	if !replaced {
+		updated = append(updated, rsvp)
+	}
+	return updated
+}
@@ -2,140 +2,156 @@ package guest
 
 import (
 	"context"
-	"deili-backend/config"
-	"errors"
-	"fmt"
-	"log"
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/listing"
 	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// Guest is a guest as stored; the API serves it through its own request and response types
 type Guest struct {
 	ID           primitive.ObjectID `bson:"_id,omitempty"`
 	Name         string             `bson:"name"`
 	Message      string             `bson:"message"`
-	Confirmation string             `bson:"confirmation"`
+	Confirmation ConfirmationStatus `bson:"confirmation"`
 	ClientID     primitive.ObjectID `bson:"client_id"`
-}
 
-var guestCollection *mongo.Collection
-var database *mongo.Database
-
-// Init initializes the MongoDB connection for the guest collection
-func Init() {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	// Use mongo.Connect() directly
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.MongoURI))
-	if err != nil {
-		log.Fatal("Error connecting to MongoDB:", err)
-	}
-	database = client.Database(config.DBName)
-	guestCollection = database.Collection("guests")
-}
+	// MessageStatus moderates Message on the public wall; MessageHoldReason says why it was held
+	MessageStatus     MessageStatus `bson:"message_status,omitempty"`
+	MessageHoldReason string        `bson:"message_hold_reason,omitempty"`
 
-// CreateGuest inserts a new guest into the MongoDB guest collection
-func CreateGuest(guest Guest) (*mongo.InsertOneResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// PartySize is the number of people attending including the guest; PlusOnes names the others
+	PartySize    int      `bson:"party_size"`
+	PlusOnes     []string `bson:"plus_ones,omitempty"`
+	MaxPartySize int      `bson:"max_party_size,omitempty"`
 
-	// Validate client_id is not empty
-	if guest.ClientID.IsZero() {
-		return nil, errors.New("invalid client_id: client_id is zero")
-	}
+	// RespondedAt is when the guest last changed their answer; unset while pending
+	RespondedAt time.Time `bson:"responded_at,omitempty"`
 
-	// Check if the client exists
-	clientExists, err := validateClient(guest.ClientID)
-	if err != nil {
-		return nil, fmt.Errorf("error validating client: %v", err)
-	}
-	if !clientExists {
-		return nil, fmt.Errorf("client with ID %s does not exist", guest.ClientID.Hex())
-	}
+	// InvitedEventIDs limits which of the client's events the guest is invited to; empty means all
+	InvitedEventIDs []primitive.ObjectID `bson:"invited_event_ids,omitempty"`
+	EventRSVPs      []EventRSVP          `bson:"event_rsvps,omitempty"`
 
-	result, err := guestCollection.InsertOne(ctx, guest)
-	if err != nil {
-		return nil, fmt.Errorf("error inserting guest: %v", err)
-	}
+	// Phone and Group help the couple organize pre-registered invitees, e.g. "Bride's family"
+	Phone string `bson:"phone,omitempty"`
+	Group string `bson:"group,omitempty"`
 
-	return result, nil
-}
+	// InvitationToken is set for invitees pre-registered by the couple and identifies their personal link
+	InvitationToken string `bson:"invitation_token,omitempty"`
 
-// validateClient checks if a client with the given ID exists
-func validateClient(clientID primitive.ObjectID) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
+	// CreatedAt and UpdatedAt are set by the store; guests stored before they existed have neither
+	CreatedAt time.Time `bson:"created_at,omitempty"`
+	UpdatedAt time.Time `bson:"updated_at,omitempty"`
+	// Version counts the changes made to the guest, see package revision
+	Version int64 `bson:"version"`
 
-	clientCollection := database.Collection("clients")
-	var client struct{}
-	err := clientCollection.FindOne(ctx, bson.M{"_id": clientID}).Decode(&client)
-	if err == mongo.ErrNoDocuments {
-		return false, nil
-	}
-	if err != nil {
-		return false, err
-	}
-	return true, nil
+	// DeletedAt is set while the guest is in the trash
+	DeletedAt *time.Time `bson:"deleted_at,omitempty"`
 }
 
-func GetGuestsByClient(clientID primitive.ObjectID) ([]Guest, error) {
-	var guests []Guest
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	cursor, err := guestCollection.Find(ctx, bson.M{"client_id": clientID})
-	if err != nil {
-		return nil, err
-	}
+// Patch holds the guest fields a merge patch may change. The client is not one of them: the
+// guest's invitations, answers and token only make sense for the client it belongs to.
+type Patch struct {
+	Name         string             `json:"name"`
+	Message      string             `json:"message"`
+	Confirmation ConfirmationStatus `json:"confirmation"`
+	PartySize    int                `json:"party_size"`
+	PlusOnes     []string           `json:"plus_ones"`
+	MaxPartySize int                `json:"max_party_size"`
+	Phone        string             `json:"phone"`
+	Group        string             `json:"group"`
+}
 
-	if err = cursor.All(ctx, &guests); err != nil {
-		return nil, err
+// Patch returns the patchable view of the guest
+func (g Guest) Patch() Patch {
+	return Patch{
+		Name:         g.Name,
+		Message:      g.Message,
+		Confirmation: g.Confirmation,
+		PartySize:    g.PartySize,
+		PlusOnes:     g.PlusOnes,
+		MaxPartySize: g.MaxPartySize,
+		Phone:        g.Phone,
+		Group:        g.Group,
 	}
-
-	return guests, nil
 }
 
-// GetGuestByID retrieves a guest by its ObjectID
-func GetGuestByID(id primitive.ObjectID) (*Guest, error) {
-	var guest Guest
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	err := guestCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&guest)
-	return &guest, err
+// Apply returns a copy of g with the patched fields
+func (p Patch) Apply(g Guest) Guest {
+	g.Name = p.Name
+	g.Message = p.Message
+	g.Confirmation = p.Confirmation
+	g.PartySize = p.PartySize
+	g.PlusOnes = p.PlusOnes
+	g.MaxPartySize = p.MaxPartySize
+	g.Phone = p.Phone
+	g.Group = p.Group
+	return g
 }
 
-// UpdateGuest updates an existing guest's information
-func UpdateGuest(id primitive.ObjectID, updatedData Guest) (*mongo.UpdateResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// Validate client_id is not empty
-	if updatedData.ClientID.IsZero() {
-		return nil, errors.New("invalid client_id: client_id is zero")
-	}
-
-	filter := bson.M{"_id": id}
-	update := bson.M{
-		"$set": bson.M{
-			"name":         updatedData.Name,
-			"message":      updatedData.Message,
-			"confirmation": updatedData.Confirmation,
-			"client_id":    updatedData.ClientID,
-		},
-	}
+var (
+	// ErrNotFound is returned when no guest has the requested ID
+	ErrNotFound = apperror.NotFound("guest")
+	// ErrInvitationNotFound is returned when no invitee owns an invitation token
+	ErrInvitationNotFound = apperror.NotFound("invitation")
+)
 
-	return guestCollection.UpdateOne(ctx, filter, update)
+// listKey returns the fields guests are sorted and paginated by
+func listKey(g Guest) (string, primitive.ObjectID) {
+	return g.Name, g.ID
 }
 
-// DeleteGuest deletes a guest from the collection based on its ObjectID
-func DeleteGuest(id primitive.ObjectID) (*mongo.DeleteResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	return guestCollection.DeleteOne(ctx, bson.M{"_id": id})
+// ExportTimeout bounds how long ForEachGuest may stream one guest list
+const ExportTimeout = 5 * time.Minute
+
+// GuestStore is the set of operations available on persisted guests
+type GuestStore interface {
+	CreateGuest(ctx context.Context, guest Guest) (*mongo.InsertOneResult, error)
+	// CreateGuests inserts guests of one client in a single unordered batch
+	CreateGuests(ctx context.Context, clientID primitive.ObjectID, guests []Guest) (*mongo.InsertManyResult, error)
+	GetGuestsByClient(ctx context.Context, clientID primitive.ObjectID) ([]Guest, error)
+	// ListGuests returns one page of a client's guests, optionally only those with one of the
+	// given statuses; q must be normalized
+	ListGuests(ctx context.Context, clientID primitive.ObjectID, statuses []ConfirmationStatus, q listing.Query) (*listing.Page[Guest], error)
+	// ForEachGuest calls fn for each of the client's guests without loading them all into memory,
+	// optionally only those with one of the given statuses; it stops at the first error fn returns
+	ForEachGuest(ctx context.Context, clientID primitive.ObjectID, statuses []ConfirmationStatus, fn func(Guest) error) error
+	GetGuestByID(ctx context.Context, id primitive.ObjectID) (*Guest, error)
+	GetGuestByInvitationToken(ctx context.Context, token string) (*Guest, error)
+	// UpdateGuest writes the fields covered by Patch to the guest at updatedData.Version and
+	// returns the updated guest; it returns revision.ErrConflict when the guest has changed since
+	UpdateGuest(ctx context.Context, id primitive.ObjectID, updatedData Guest) (*Guest, error)
+	// DeleteGuest moves a guest at version to the trash; it returns revision.ErrConflict when
+	// the guest has changed since
+	DeleteGuest(ctx context.Context, id primitive.ObjectID, version int64) (*mongo.DeleteResult, error)
+
+	// Bulk operations used when a client is deleted or restored; guests trashed together with
+	// their client share its deletion time
+	CountGuestsByClient(ctx context.Context, clientID primitive.ObjectID) (int64, error)
+	DeleteGuestsByClient(ctx context.Context, clientID primitive.ObjectID, at time.Time) (*mongo.DeleteResult, error)
+	RestoreGuestsByClient(ctx context.Context, clientID primitive.ObjectID, deletedAt time.Time) (int64, error)
+
+	// Trash; guests in it are left out of every other operation
+	// ListDeletedGuests returns one page of the trashed guests of a client, or of every client
+	// when clientID is zero; q must be normalized
+	ListDeletedGuests(ctx context.Context, clientID primitive.ObjectID, q listing.Query) (*listing.Page[Guest], error)
+	// RestoreGuest takes a guest out of the trash and returns it; its client must not be in the trash
+	RestoreGuest(ctx context.Context, id primitive.ObjectID) (*Guest, error)
+	// PurgeGuests permanently deletes the guests trashed before cutoff and returns how many
+	PurgeGuests(ctx context.Context, cutoff time.Time) (int64, error)
+
+	// Message wall; statuses including MessageApproved also match messages without a status.
+	// Writes taking a version return revision.ErrConflict when the guest has changed since.
+	ListMessages(ctx context.Context, clientID primitive.ObjectID, statuses []MessageStatus, q listing.Query) (*listing.Page[Guest], error)
+	SetMessageStatus(ctx context.Context, id primitive.ObjectID, version int64, status MessageStatus) (*Guest, error)
+
+	// Per-event invitations and RSVPs
+	SetInvitedEvents(ctx context.Context, id primitive.ObjectID, version int64, eventIDs []primitive.ObjectID) (*mongo.UpdateResult, error)
+	SetEventRSVP(ctx context.Context, id primitive.ObjectID, version int64, rsvp EventRSVP) (*mongo.UpdateResult, error)
+	RemoveEvent(ctx context.Context, eventID primitive.ObjectID) error
+
+	// GetClientStats summarizes a client's RSVPs, bucketing the timeline by day in loc
+	GetClientStats(ctx context.Context, clientID primitive.ObjectID, loc *time.Location) (*Stats, error)
 }
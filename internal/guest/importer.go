@@ -0,0 +1,156 @@
+package guest
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ImportRow is one data row of a guest import file
+type ImportRow struct {
+	// Line is the 1-based line number in the file, counting the header
+	Line  int
+	Guest Guest
+	Err   error
+}
+
+// importColumns maps accepted header spellings to the field they fill
+var importColumns = map[string]string{
+	"name":           "name",
+	"phone":          "phone",
+	"phone_number":   "phone",
+	"group":          "group",
+	"max_party_size": "max_party_size",
+	"party_size":     "max_party_size",
+}
+
+// ReadImportCSV parses a guest import file with a header row containing at least "name",
+// and optionally "phone", "group" and "max_party_size". Row problems are reported on the
+// row; only an unreadable file or header returns an error.
+func ReadImportCSV(r io.Reader, clientID primitive.ObjectID) ([]ImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("import file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read header: %w", err)
+	}
+
+	fields := make([]string, len(header))
+	hasName := false
+	for i, h := range header {
+		key := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\uFEFF")))
+		key = strings.NewReplacer(" ", "_", "-", "_").Replace(key)
+		fields[i] = importColumns[key]
+		hasName = hasName || fields[i] == "name"
+	}
+	if !hasName {
+		return nil, errors.New(`header must contain a "name" column`)
+	}
+
+	var rows []ImportRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rows = append(rows, ImportRow{Line: line, Err: err})
+				continue
+			}
+			return nil, err
+		}
+		if isBlankRecord(record) {
+			continue
+		}
+
+		row := ImportRow{Line: line, Guest: Guest{ClientID: clientID, Confirmation: StatusPending}}
+		for i, value := range record {
+			if i >= len(fields) {
+				break
+			}
+			value = strings.TrimSpace(value)
+			switch fields[i] {
+			case "name":
+				row.Guest.Name = value
+			case "phone":
+				row.Guest.Phone, row.Err = NormalizePhone(value)
+			case "group":
+				row.Guest.Group = value
+			case "max_party_size":
+				if value != "" {
+					n, err := strconv.Atoi(value)
+					if err != nil || n < 1 {
+						row.Err = fmt.Errorf("max_party_size must be a positive whole number, got %q", value)
+					}
+					row.Guest.MaxPartySize = n
+				}
+			}
+			if row.Err != nil {
+				break
+			}
+		}
+		if row.Err == nil && row.Guest.Name == "" {
+			row.Err = errors.New("name cannot be empty")
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// NormalizePhone keeps a leading "+" and the digits of a phone number, dropping spaces,
+// dashes, dots and parentheses
+func NormalizePhone(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+
+	var b strings.Builder
+	for i, r := range value {
+		switch {
+		case unicode.IsDigit(r):
+			b.WriteRune(r)
+		case r == '+' && i == 0:
+			b.WriteRune(r)
+		case strings.ContainsRune(" -.()", r):
+		default:
+			return "", fmt.Errorf("phone %q contains invalid characters", value)
+		}
+	}
+	digits := strings.TrimPrefix(b.String(), "+")
+	if len(digits) < 6 || len(digits) > 15 {
+		return "", fmt.Errorf("phone %q must have between 6 and 15 digits", value)
+	}
+	return b.String(), nil
+}
+
+// DedupKey identifies the same invitee across imports: the phone number when there is one,
+// otherwise the case-insensitive name
+func DedupKey(g Guest) string {
+	if g.Phone != "" {
+		return "phone:" + strings.TrimPrefix(g.Phone, "+")
+	}
+	return "name:" + strings.Join(strings.Fields(strings.ToLower(g.Name)), " ")
+}
+
+func isBlankRecord(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,24 @@
+package guest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+)
+
+// invitationTokenBytes gives 192 bits of entropy, far beyond what can be guessed by enumeration
+const invitationTokenBytes = 24
+
+// NewInvitationToken returns a random URL-safe token for a personalized invitation link
+func NewInvitationToken() (string, error) {
+	b := make([]byte, invitationTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// InvitationLink builds the personalized "Dear <name>" link the couple sends to an invitee
+func InvitationLink(baseURL, token string) string {
+	return strings.TrimRight(baseURL, "/") + "/invitation/" + token
+}
@@ -0,0 +1,521 @@
+package guest
+
+import (
+	"context"
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/client"
+	"deili-backend/internal/listing"
+	"deili-backend/internal/revision"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MemoryStore is a thread-safe in-memory GuestStore, useful for tests and local development
+type MemoryStore struct {
+	mu      sync.RWMutex
+	guests  map[primitive.ObjectID]Guest
+	clients client.ClientStore
+
+	// trash holds deleted guests apart, so the other operations never see them
+	trash map[primitive.ObjectID]Guest
+}
+
+var _ GuestStore = (*MemoryStore)(nil)
+
+// NewMemoryStore returns an empty guest store that validates client IDs against clients
+func NewMemoryStore(clients client.ClientStore) *MemoryStore {
+	return &MemoryStore{
+		guests:  make(map[primitive.ObjectID]Guest),
+		trash:   make(map[primitive.ObjectID]Guest),
+		clients: clients,
+	}
+}
+
+// CreateGuest stores a new guest after checking that its client exists
+func (s *MemoryStore) CreateGuest(ctx context.Context, guest Guest) (*mongo.InsertOneResult, error) {
+	// Validate client_id is not empty
+	if guest.ClientID.IsZero() {
+		return nil, apperror.InvalidField("client_id", "cannot be zero")
+	}
+
+	if err := normalizeRSVP(&guest, guest.EffectiveMaxPartySize()); err != nil {
+		return nil, err
+	}
+	guest.RespondedAt = respondedAt(guest.Confirmation, StatusPending, time.Time{})
+	guest.DeletedAt = nil
+	guest.CreatedAt = revision.Now()
+	guest.UpdatedAt = guest.CreatedAt
+	guest.Version = 1
+
+	// Check if the client exists
+	if _, err := s.clients.GetClientByID(ctx, guest.ClientID); err != nil {
+		if errors.Is(err, client.ErrNotFound) {
+			return nil, apperror.InvalidField("client_id", "client %s does not exist", guest.ClientID.Hex())
+		}
+		return nil, fmt.Errorf("error validating client: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if guest.ID.IsZero() {
+		guest.ID = primitive.NewObjectID()
+	}
+	_, exists := s.guests[guest.ID]
+	if _, trashed := s.trash[guest.ID]; exists || trashed {
+		return nil, apperror.Conflict("guest %s already exists", guest.ID.Hex())
+	}
+	s.guests[guest.ID] = guest
+	return &mongo.InsertOneResult{InsertedID: guest.ID}, nil
+}
+
+// CreateGuests validates and stores a batch of guests for one client
+func (s *MemoryStore) CreateGuests(ctx context.Context, clientID primitive.ObjectID, guests []Guest) (*mongo.InsertManyResult, error) {
+	if clientID.IsZero() {
+		return nil, apperror.InvalidField("client_id", "cannot be zero")
+	}
+	if _, err := s.clients.GetClientByID(ctx, clientID); err != nil {
+		if errors.Is(err, client.ErrNotFound) {
+			return nil, apperror.InvalidField("client_id", "client %s does not exist", clientID.Hex())
+		}
+		return nil, fmt.Errorf("error validating client: %w", err)
+	}
+
+	created := revision.Now()
+	batch := make([]Guest, len(guests))
+	for i, guest := range guests {
+		guest.ClientID = clientID
+		if err := normalizeRSVP(&guest, guest.EffectiveMaxPartySize()); err != nil {
+			return nil, fmt.Errorf("guest %d: %w", i, err)
+		}
+		guest.RespondedAt = respondedAt(guest.Confirmation, StatusPending, time.Time{})
+		guest.DeletedAt = nil
+		guest.CreatedAt, guest.UpdatedAt = created, created
+		guest.Version = 1
+		if guest.ID.IsZero() {
+			guest.ID = primitive.NewObjectID()
+		}
+		batch[i] = guest
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &mongo.InsertManyResult{}
+	for _, guest := range batch {
+		s.guests[guest.ID] = guest
+		result.InsertedIDs = append(result.InsertedIDs, guest.ID)
+	}
+	return result, nil
+}
+
+// GetGuestsByClient returns the guests of a client ordered by ID
+func (s *MemoryStore) GetGuestsByClient(ctx context.Context, clientID primitive.ObjectID) ([]Guest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var guests []Guest
+	for _, g := range s.guests {
+		if g.ClientID == clientID {
+			guests = append(guests, g)
+		}
+	}
+	sort.Slice(guests, func(i, j int) bool {
+		return guests[i].ID.Hex() < guests[j].ID.Hex()
+	})
+	return guests, nil
+}
+
+// ListGuests returns one page of a client's guests
+func (s *MemoryStore) ListGuests(ctx context.Context, clientID primitive.ObjectID, statuses []ConfirmationStatus, q listing.Query) (*listing.Page[Guest], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var guests []Guest
+	for _, g := range s.guests {
+		if g.ClientID == clientID && (len(statuses) == 0 || slices.Contains(statuses, g.Confirmation)) {
+			guests = append(guests, g)
+		}
+	}
+	page := listing.Paginate(guests, q, listKey)
+	return &page, nil
+}
+
+// ForEachGuest iterates over a snapshot of the client's guests ordered by ID
+func (s *MemoryStore) ForEachGuest(ctx context.Context, clientID primitive.ObjectID, statuses []ConfirmationStatus, fn func(Guest) error) error {
+	guests, err := s.GetGuestsByClient(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	for _, g := range guests {
+		if len(statuses) > 0 && !slices.Contains(statuses, g.Confirmation) {
+			continue
+		}
+		if err := fn(g); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetGuestByID returns ErrNotFound when the guest does not exist, like the Mongo store
+func (s *MemoryStore) GetGuestByID(ctx context.Context, id primitive.ObjectID) (*Guest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	guest, ok := s.guests[id]
+	if !ok {
+		return &Guest{}, ErrNotFound
+	}
+	return &guest, nil
+}
+
+// GetGuestByInvitationToken returns ErrInvitationNotFound when no invitee owns the token
+func (s *MemoryStore) GetGuestByInvitationToken(ctx context.Context, token string) (*Guest, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if token != "" {
+		for _, g := range s.guests {
+			if g.InvitationToken == token {
+				return &g, nil
+			}
+		}
+	}
+	return &Guest{}, ErrInvitationNotFound
+}
+
+// UpdateGuest writes the patchable fields of an existing guest and returns the updated copy
+func (s *MemoryStore) UpdateGuest(ctx context.Context, id primitive.ObjectID, updatedData Guest) (*Guest, error) {
+	if err := validateUpdate(&updatedData); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.guests[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if existing.Version != updatedData.Version {
+		return nil, revision.ErrConflict
+	}
+	updated := updatedData.Patch().Apply(existing)
+	updated.RespondedAt = respondedAt(updatedData.Confirmation, existing.Confirmation, existing.RespondedAt)
+	updated.MessageStatus, updated.MessageHoldReason = updatedData.MessageStatus, updatedData.MessageHoldReason
+	updated.UpdatedAt = revision.Now()
+	updated.Version++
+	s.guests[id] = updated
+	return &updated, nil
+}
+
+// DeleteGuest moves a guest at version to the trash
+func (s *MemoryStore) DeleteGuest(ctx context.Context, id primitive.ObjectID, version int64) (*mongo.DeleteResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.guests[id]
+	if !ok {
+		return &mongo.DeleteResult{}, nil
+	}
+	if existing.Version != version {
+		return nil, revision.ErrConflict
+	}
+	s.moveToTrash(id, revision.Now())
+	return &mongo.DeleteResult{DeletedCount: 1}, nil
+}
+
+// moveToTrash stamps a live guest with at, counts it as an update and moves it to the trash;
+// s.mu must be held
+func (s *MemoryStore) moveToTrash(id primitive.ObjectID, at time.Time) {
+	g := s.guests[id]
+	g.DeletedAt = &at
+	g.UpdatedAt = at
+	g.Version++
+	s.trash[id] = g
+	delete(s.guests, id)
+}
+
+// CountGuestsByClient counts the guests belonging to a client
+func (s *MemoryStore) CountGuestsByClient(ctx context.Context, clientID primitive.ObjectID) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for _, g := range s.guests {
+		if g.ClientID == clientID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// DeleteGuestsByClient moves every guest belonging to a client to the trash
+func (s *MemoryStore) DeleteGuestsByClient(ctx context.Context, clientID primitive.ObjectID, at time.Time) (*mongo.DeleteResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &mongo.DeleteResult{}
+	for id, g := range s.guests {
+		if g.ClientID == clientID {
+			s.moveToTrash(id, at)
+			result.DeletedCount++
+		}
+	}
+	return result, nil
+}
+
+// RestoreGuestsByClient takes the client's guests trashed at deletedAt out of the trash
+func (s *MemoryStore) RestoreGuestsByClient(ctx context.Context, clientID primitive.ObjectID, deletedAt time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var restored int64
+	for id, g := range s.trash {
+		if g.ClientID == clientID && g.DeletedAt.Equal(deletedAt) {
+			s.takeFromTrash(id)
+			restored++
+		}
+	}
+	return restored, nil
+}
+
+// ListDeletedGuests returns one page of the guests in the trash
+func (s *MemoryStore) ListDeletedGuests(ctx context.Context, clientID primitive.ObjectID, q listing.Query) (*listing.Page[Guest], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var guests []Guest
+	for _, g := range s.trash {
+		if clientID.IsZero() || g.ClientID == clientID {
+			guests = append(guests, g)
+		}
+	}
+	page := listing.Paginate(guests, q, listKey)
+	return &page, nil
+}
+
+// RestoreGuest moves a guest back out of the trash once its client is known to be live
+func (s *MemoryStore) RestoreGuest(ctx context.Context, id primitive.ObjectID) (*Guest, error) {
+	s.mu.RLock()
+	trashed, ok := s.trash[id]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if _, err := s.clients.GetClientByID(ctx, trashed.ClientID); err != nil {
+		if errors.Is(err, client.ErrNotFound) {
+			return nil, apperror.Conflict("client %s is deleted, restore it first", trashed.ClientID.Hex())
+		}
+		return nil, fmt.Errorf("error validating client: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.trash[id]; !ok {
+		return nil, ErrNotFound
+	}
+	restored := s.takeFromTrash(id)
+	return &restored, nil
+}
+
+// takeFromTrash moves a trashed guest back, counting it as an update, and returns it; s.mu must
+// be held
+func (s *MemoryStore) takeFromTrash(id primitive.ObjectID) Guest {
+	g := s.trash[id]
+	g.DeletedAt = nil
+	g.UpdatedAt = revision.Now()
+	g.Version++
+	s.guests[id] = g
+	delete(s.trash, id)
+	return g
+}
+
+// PurgeGuests permanently deletes the guests trashed before cutoff
+func (s *MemoryStore) PurgeGuests(ctx context.Context, cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var purged int64
+	for id, g := range s.trash {
+		if g.DeletedAt.Before(cutoff) {
+			delete(s.trash, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// ListMessages returns one page of a client's guests who left a message with one of the statuses
+func (s *MemoryStore) ListMessages(ctx context.Context, clientID primitive.ObjectID, statuses []MessageStatus, q listing.Query) (*listing.Page[Guest], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var guests []Guest
+	for _, g := range s.guests {
+		status := g.MessageStatus
+		if status == "" {
+			status = MessageApproved
+		}
+		if g.ClientID == clientID && g.Message != "" && slices.Contains(statuses, status) {
+			guests = append(guests, g)
+		}
+	}
+	page := listing.Paginate(guests, q, listKey)
+	return &page, nil
+}
+
+// SetMessageStatus records the couple's moderation decision on the guest at version and returns
+// the updated copy
+func (s *MemoryStore) SetMessageStatus(ctx context.Context, id primitive.ObjectID, version int64, status MessageStatus) (*Guest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.guests[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if existing.Version != version {
+		return nil, revision.ErrConflict
+	}
+	existing.MessageStatus = status
+	existing.UpdatedAt = revision.Now()
+	existing.Version++
+	s.guests[id] = existing
+	return &existing, nil
+}
+
+// SetInvitedEvents records which events the guest at version is invited to and drops answers
+// for the others
+func (s *MemoryStore) SetInvitedEvents(ctx context.Context, id primitive.ObjectID, version int64, eventIDs []primitive.ObjectID) (*mongo.UpdateResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.guests[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if existing.Version != version {
+		return nil, revision.ErrConflict
+	}
+	existing.InvitedEventIDs = append([]primitive.ObjectID(nil), eventIDs...)
+	existing.EventRSVPs = keepInvitedRSVPs(existing)
+	existing.UpdatedAt = revision.Now()
+	existing.Version++
+	s.guests[id] = existing
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+// SetEventRSVP records or replaces the answer of the guest at version for one event
+func (s *MemoryStore) SetEventRSVP(ctx context.Context, id primitive.ObjectID, version int64, rsvp EventRSVP) (*mongo.UpdateResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.guests[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if existing.Version != version {
+		return nil, revision.ErrConflict
+	}
+	if err := NormalizeEventRSVP(existing, &rsvp); err != nil {
+		return nil, err
+	}
+
+	existing.EventRSVPs = withEventRSVP(existing.EventRSVPs, rsvp)
+	existing.UpdatedAt = revision.Now()
+	existing.Version++
+	s.guests[id] = existing
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+// RemoveEvent drops a deleted event's answers from every guest, trashed ones included so they
+// are restored without them, keeping invited_event_ids as is
+func (s *MemoryStore) RemoveEvent(ctx context.Context, eventID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, guests := range []map[primitive.ObjectID]Guest{s.guests, s.trash} {
+		for id, g := range guests {
+			if _, ok := g.EventRSVP(eventID); !ok {
+				continue
+			}
+			var rsvps []EventRSVP
+			for _, r := range g.EventRSVPs {
+				if r.EventID != eventID {
+					rsvps = append(rsvps, r)
+				}
+			}
+			g.EventRSVPs = rsvps
+			g.UpdatedAt = revision.Now()
+			g.Version++
+			guests[id] = g
+		}
+	}
+	return nil
+}
+
+// GetClientStats summarizes a client's RSVPs the same way the Mongo aggregation does
+func (s *MemoryStore) GetClientStats(ctx context.Context, clientID primitive.ObjectID, loc *time.Location) (*Stats, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := &Stats{ClientID: clientID, ByStatus: map[ConfirmationStatus]int{}}
+	days := map[string]*DailyResponses{}
+	for _, g := range s.guests {
+		if g.ClientID != clientID {
+			continue
+		}
+		stats.TotalGuests++
+		stats.ByStatus[g.Confirmation]++
+		switch g.Confirmation {
+		case StatusAttending:
+			stats.HeadCount += g.PartySize
+		case StatusMaybe:
+			stats.MaybeHeadCount += g.PartySize
+		}
+		if g.InvitationToken != "" {
+			stats.InvitedGuests++
+			if g.hasAnswered() {
+				stats.RespondedInvitees++
+			}
+		}
+		if !g.hasAnswered() {
+			continue
+		}
+
+		at := g.RespondedAt
+		if at.IsZero() {
+			at = g.ID.Timestamp()
+		}
+		date := at.In(loc).Format("2006-01-02")
+		day, ok := days[date]
+		if !ok {
+			day = &DailyResponses{Date: date}
+			days[date] = day
+		}
+		day.Responses++
+		if g.Confirmation == StatusAttending {
+			day.Attending++
+			day.HeadCount += g.PartySize
+		}
+	}
+
+	for _, day := range days {
+		stats.Timeline = append(stats.Timeline, *day)
+	}
+	sort.Slice(stats.Timeline, func(i, j int) bool {
+		return stats.Timeline[i].Date < stats.Timeline[j].Date
+	})
+	stats.finish()
+	return stats, nil
+}
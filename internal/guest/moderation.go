@@ -0,0 +1,78 @@
+package guest
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// MessageStatus is where a guest's message stands in the couple's moderation queue
+type MessageStatus string
+
+const (
+	// MessagePending messages wait for the couple
+	MessagePending MessageStatus = "pending"
+	// MessageApproved messages are shown on the public message wall. Messages stored before
+	// moderation existed have no status and count as approved, since they were public then.
+	MessageApproved MessageStatus = "approved"
+	// MessageHidden messages were rejected by the couple
+	MessageHidden MessageStatus = "hidden"
+)
+
+// Valid reports whether s is one of the known message statuses
+func (s MessageStatus) Valid() bool {
+	switch s {
+	case MessagePending, MessageApproved, MessageHidden:
+		return true
+	}
+	return false
+}
+
+// linkPattern matches URLs and bare domains, the usual payload of spam left on a message wall
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+|\b[a-z0-9-]+\.(?:com|net|org|info|biz|io|co|id|me|ly|xyz|link|site|online|app)\b`)
+
+// ModerateMessage decides the status of a new or edited message. Clean messages are approved
+// straight away; messages with a link or a word from blocklist are held for the couple with
+// the reason recorded. A message that did not change since previous keeps its status, so
+// editing an RSVP does not undo the couple's decision.
+func (g *Guest) ModerateMessage(previous Guest, blocklist []string) {
+	if g.Message == previous.Message && previous.MessageStatus != "" {
+		g.MessageStatus, g.MessageHoldReason = previous.MessageStatus, previous.MessageHoldReason
+		return
+	}
+	g.MessageStatus, g.MessageHoldReason = "", ""
+	if strings.TrimSpace(g.Message) == "" {
+		return
+	}
+
+	g.MessageStatus = MessageApproved
+	if linkPattern.MatchString(g.Message) {
+		g.MessageStatus, g.MessageHoldReason = MessagePending, "contains a link"
+		return
+	}
+	if word, ok := blockedWord(g.Message, blocklist); ok {
+		g.MessageStatus, g.MessageHoldReason = MessagePending, "contains the blocked word \""+word+"\""
+	}
+}
+
+// blockedWord returns the first blocklist entry found in message, ignoring case. Single words
+// must match a whole word; entries with spaces match anywhere.
+func blockedWord(message string, blocklist []string) (string, bool) {
+	lower := strings.ToLower(message)
+	words := map[string]bool{}
+	for _, w := range strings.FieldsFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[w] = true
+	}
+	for _, entry := range blocklist {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if words[entry] || (strings.Contains(entry, " ") && strings.Contains(lower, entry)) {
+			return entry, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,649 @@
+package guest
+
+import (
+	"context"
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/listing"
+	"deili-backend/internal/revision"
+	"deili-backend/internal/trash"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore is a GuestStore backed by the MongoDB guest collection
+type MongoStore struct {
+	database        *mongo.Database
+	guestCollection *mongo.Collection
+}
+
+var _ GuestStore = (*MongoStore)(nil)
+
+// NewMongoStore returns a store using the guests collection of the given database
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{database: db, guestCollection: db.Collection("guests")}
+}
+
+// CreateGuest inserts a new guest into the MongoDB guest collection
+func (s *MongoStore) CreateGuest(ctx context.Context, guest Guest) (*mongo.InsertOneResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	// Validate client_id is not empty
+	if guest.ClientID.IsZero() {
+		return nil, apperror.InvalidField("client_id", "cannot be zero")
+	}
+
+	if err := normalizeRSVP(&guest, guest.EffectiveMaxPartySize()); err != nil {
+		return nil, err
+	}
+	guest.RespondedAt = respondedAt(guest.Confirmation, StatusPending, time.Time{})
+	guest.DeletedAt = nil
+	guest.CreatedAt = revision.Now()
+	guest.UpdatedAt = guest.CreatedAt
+	guest.Version = 1
+
+	// Check if the client exists
+	clientExists, err := s.validateClient(ctx, guest.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("error validating client: %w", err)
+	}
+	if !clientExists {
+		return nil, apperror.InvalidField("client_id", "client %s does not exist", guest.ClientID.Hex())
+	}
+
+	result, err := s.guestCollection.InsertOne(ctx, guest)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting guest: %w", err)
+	}
+
+	return result, nil
+}
+
+// CreateGuests validates every guest and inserts them with one unordered InsertMany, so a
+// failing document does not stop the rest of the batch
+func (s *MongoStore) CreateGuests(ctx context.Context, clientID primitive.ObjectID, guests []Guest) (*mongo.InsertManyResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	if clientID.IsZero() {
+		return nil, apperror.InvalidField("client_id", "cannot be zero")
+	}
+	clientExists, err := s.validateClient(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("error validating client: %w", err)
+	}
+	if !clientExists {
+		return nil, apperror.InvalidField("client_id", "client %s does not exist", clientID.Hex())
+	}
+
+	created := revision.Now()
+	docs := make([]interface{}, len(guests))
+	for i := range guests {
+		guest := guests[i]
+		guest.ClientID = clientID
+		if err := normalizeRSVP(&guest, guest.EffectiveMaxPartySize()); err != nil {
+			return nil, fmt.Errorf("guest %d: %w", i, err)
+		}
+		guest.RespondedAt = respondedAt(guest.Confirmation, StatusPending, time.Time{})
+		guest.DeletedAt = nil
+		guest.CreatedAt, guest.UpdatedAt = created, created
+		guest.Version = 1
+		docs[i] = guest
+	}
+
+	return s.guestCollection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+}
+
+// validateClient checks if a client with the given ID exists and is not in the trash
+func (s *MongoStore) validateClient(ctx context.Context, clientID primitive.ObjectID) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	clientCollection := s.database.Collection("clients")
+	var client struct{}
+	err := clientCollection.FindOne(ctx, trash.Live(bson.M{"_id": clientID})).Decode(&client)
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *MongoStore) GetGuestsByClient(ctx context.Context, clientID primitive.ObjectID) ([]Guest, error) {
+	var guests []Guest
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := s.guestCollection.Find(ctx, trash.Live(bson.M{"client_id": clientID}))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = cursor.All(ctx, &guests); err != nil {
+		return nil, err
+	}
+
+	return guests, nil
+}
+
+// ListGuests retrieves one page of a client's guests
+func (s *MongoStore) ListGuests(ctx context.Context, clientID primitive.ObjectID, statuses []ConfirmationStatus, q listing.Query) (*listing.Page[Guest], error) {
+	var guests []Guest
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	base := trash.Live(bson.M{"client_id": clientID})
+	if len(statuses) > 0 {
+		base["confirmation"] = bson.M{"$in": statuses}
+	}
+	total, err := s.guestCollection.CountDocuments(ctx, q.CountFilter(base), q.CountOptions())
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := s.guestCollection.Find(ctx, q.MongoFilter(base), q.FindOptions())
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &guests); err != nil {
+		return nil, err
+	}
+
+	page := listing.NewPage(guests, total, q, listKey)
+	return &page, nil
+}
+
+// ForEachGuest streams a client's guests from a cursor in insertion order
+func (s *MongoStore) ForEachGuest(ctx context.Context, clientID primitive.ObjectID, statuses []ConfirmationStatus, fn func(Guest) error) error {
+	// Exports of large guest lists can take a while; the request context still cancels it
+	ctx, cancel := context.WithTimeout(ctx, ExportTimeout)
+	defer cancel()
+
+	filter := trash.Live(bson.M{"client_id": clientID})
+	if len(statuses) > 0 {
+		filter["confirmation"] = bson.M{"$in": statuses}
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetBatchSize(500)
+	cursor, err := s.guestCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var guest Guest
+		if err := cursor.Decode(&guest); err != nil {
+			return err
+		}
+		if err := fn(guest); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// GetGuestByID retrieves a guest by its ObjectID
+func (s *MongoStore) GetGuestByID(ctx context.Context, id primitive.ObjectID) (*Guest, error) {
+	var guest Guest
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := s.guestCollection.FindOne(ctx, trash.Live(bson.M{"_id": id})).Decode(&guest)
+	if err == mongo.ErrNoDocuments {
+		return &guest, ErrNotFound
+	}
+	return &guest, err
+}
+
+// GetGuestByInvitationToken retrieves the pre-registered invitee owning a personalized link token
+func (s *MongoStore) GetGuestByInvitationToken(ctx context.Context, token string) (*Guest, error) {
+	var guest Guest
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := s.guestCollection.FindOne(ctx, trash.Live(bson.M{"invitation_token": token})).Decode(&guest)
+	if err == mongo.ErrNoDocuments {
+		return &guest, ErrInvitationNotFound
+	}
+	return &guest, err
+}
+
+// UpdateGuest writes the patchable fields of an existing guest and returns the updated document;
+// the owning client cannot change
+func (s *MongoStore) UpdateGuest(ctx context.Context, id primitive.ObjectID, updatedData Guest) (*Guest, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	if err := validateUpdate(&updatedData); err != nil {
+		return nil, err
+	}
+
+	var existing Guest
+	err := s.guestCollection.FindOne(ctx, trash.Live(bson.M{"_id": id})).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if existing.Version != updatedData.Version {
+		return nil, revision.ErrConflict
+	}
+	fields := bson.M{
+		"name":           updatedData.Name,
+		"message":        updatedData.Message,
+		"confirmation":   updatedData.Confirmation,
+		"party_size":     updatedData.PartySize,
+		"plus_ones":      updatedData.PlusOnes,
+		"max_party_size": updatedData.MaxPartySize,
+		"phone":          updatedData.Phone,
+		"group":          updatedData.Group,
+		"updated_at":     revision.Now(),
+	}
+	// A guest without a message has no status; the validator only accepts the moderation ones
+	unset := bson.M{}
+	if updatedData.MessageStatus == "" {
+		unset["message_status"] = ""
+	} else {
+		fields["message_status"] = updatedData.MessageStatus
+	}
+	if updatedData.MessageHoldReason == "" {
+		unset["message_hold_reason"] = ""
+	} else {
+		fields["message_hold_reason"] = updatedData.MessageHoldReason
+	}
+
+	if at := respondedAt(updatedData.Confirmation, existing.Confirmation, existing.RespondedAt); at.IsZero() {
+		unset["responded_at"] = ""
+	} else {
+		fields["responded_at"] = at
+	}
+	update := revision.Bump(bson.M{"$set": fields})
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated Guest
+	err = s.guestCollection.FindOneAndUpdate(ctx, revision.Match(trash.Live(bson.M{"_id": id}), existing.Version), update, opts).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		// The guest was read above, so another request changed or deleted it in between
+		return nil, revision.ErrConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteGuest moves a guest at version to the trash by setting its deleted_at
+func (s *MongoStore) DeleteGuest(ctx context.Context, id primitive.ObjectID, version int64) (*mongo.DeleteResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	at := revision.Now()
+	update := revision.Bump(bson.M{"$set": bson.M{trash.Field: at, "updated_at": at}})
+	result, err := s.guestCollection.UpdateOne(ctx, revision.Match(trash.Live(bson.M{"_id": id}), version), update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		err := s.conflictOrNotFound(ctx, id)
+		if err == ErrNotFound {
+			return &mongo.DeleteResult{}, nil
+		}
+		return nil, err
+	}
+	return &mongo.DeleteResult{DeletedCount: result.ModifiedCount}, nil
+}
+
+// conflictOrNotFound explains why a write at a version matched no guest: either another
+// request changed the guest first or it is gone
+func (s *MongoStore) conflictOrNotFound(ctx context.Context, id primitive.ObjectID) error {
+	count, err := s.guestCollection.CountDocuments(ctx, trash.Live(bson.M{"_id": id}))
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return revision.ErrConflict
+	}
+	return ErrNotFound
+}
+
+// CountGuestsByClient counts the guests belonging to a client
+func (s *MongoStore) CountGuestsByClient(ctx context.Context, clientID primitive.ObjectID) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	return s.guestCollection.CountDocuments(ctx, trash.Live(bson.M{"client_id": clientID}))
+}
+
+// DeleteGuestsByClient moves every guest belonging to a client to the trash
+func (s *MongoStore) DeleteGuestsByClient(ctx context.Context, clientID primitive.ObjectID, at time.Time) (*mongo.DeleteResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	update := revision.Bump(bson.M{"$set": bson.M{trash.Field: at, "updated_at": at}})
+	result, err := s.guestCollection.UpdateMany(ctx, trash.Live(bson.M{"client_id": clientID}), update)
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.DeleteResult{DeletedCount: result.ModifiedCount}, nil
+}
+
+// RestoreGuestsByClient takes the client's guests trashed at deletedAt out of the trash
+func (s *MongoStore) RestoreGuestsByClient(ctx context.Context, clientID primitive.ObjectID, deletedAt time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := s.guestCollection.UpdateMany(ctx,
+		bson.M{"client_id": clientID, trash.Field: deletedAt},
+		revision.Bump(bson.M{"$unset": bson.M{trash.Field: ""}, "$set": bson.M{"updated_at": revision.Now()}}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// ListDeletedGuests retrieves one page of the guests in the trash
+func (s *MongoStore) ListDeletedGuests(ctx context.Context, clientID primitive.ObjectID, q listing.Query) (*listing.Page[Guest], error) {
+	var guests []Guest
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	base := trash.Only(bson.M{})
+	if !clientID.IsZero() {
+		base["client_id"] = clientID
+	}
+	total, err := s.guestCollection.CountDocuments(ctx, q.CountFilter(base), q.CountOptions())
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := s.guestCollection.Find(ctx, q.MongoFilter(base), q.FindOptions())
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &guests); err != nil {
+		return nil, err
+	}
+
+	page := listing.NewPage(guests, total, q, listKey)
+	return &page, nil
+}
+
+// RestoreGuest unsets deleted_at once it has checked that the guest's client is not in the trash
+func (s *MongoStore) RestoreGuest(ctx context.Context, id primitive.ObjectID) (*Guest, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var trashed Guest
+	err := s.guestCollection.FindOne(ctx, trash.Only(bson.M{"_id": id})).Decode(&trashed)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	clientExists, err := s.validateClient(ctx, trashed.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("error validating client: %w", err)
+	}
+	if !clientExists {
+		return nil, apperror.Conflict("client %s is deleted, restore it first", trashed.ClientID.Hex())
+	}
+
+	update := revision.Bump(bson.M{"$unset": bson.M{trash.Field: ""}, "$set": bson.M{"updated_at": revision.Now()}})
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var restored Guest
+	err = s.guestCollection.FindOneAndUpdate(ctx, trash.Only(bson.M{"_id": id}), update, opts).Decode(&restored)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &restored, nil
+}
+
+// PurgeGuests permanently deletes the guests trashed before cutoff
+func (s *MongoStore) PurgeGuests(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := s.guestCollection.DeleteMany(ctx, trash.DeletedBefore(bson.M{}, cutoff))
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// ListMessages retrieves one page of a client's guests who left a message with one of the statuses
+func (s *MongoStore) ListMessages(ctx context.Context, clientID primitive.ObjectID, statuses []MessageStatus, q listing.Query) (*listing.Page[Guest], error) {
+	var guests []Guest
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	base := trash.Live(bson.M{
+		"client_id": clientID,
+		"message":   bson.M{"$nin": bson.A{"", nil}},
+	})
+	if slices.Contains(statuses, MessageApproved) {
+		base["$or"] = bson.A{
+			bson.M{"message_status": bson.M{"$in": statuses}},
+			bson.M{"message_status": bson.M{"$exists": false}},
+		}
+	} else {
+		base["message_status"] = bson.M{"$in": statuses}
+	}
+	total, err := s.guestCollection.CountDocuments(ctx, q.CountFilter(base), q.CountOptions())
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := s.guestCollection.Find(ctx, q.MongoFilter(base), q.FindOptions())
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &guests); err != nil {
+		return nil, err
+	}
+
+	page := listing.NewPage(guests, total, q, listKey)
+	return &page, nil
+}
+
+// SetMessageStatus records the couple's moderation decision on the guest at version and returns
+// the updated guest
+func (s *MongoStore) SetMessageStatus(ctx context.Context, id primitive.ObjectID, version int64, status MessageStatus) (*Guest, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var updated Guest
+	err := s.guestCollection.FindOneAndUpdate(ctx,
+		revision.Match(trash.Live(bson.M{"_id": id}), version),
+		revision.Bump(bson.M{"$set": bson.M{"message_status": status, "updated_at": revision.Now()}}),
+		opts,
+	).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return nil, s.conflictOrNotFound(ctx, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// SetInvitedEvents records which events the guest at version is invited to and drops answers
+// for the others
+func (s *MongoStore) SetInvitedEvents(ctx context.Context, id primitive.ObjectID, version int64, eventIDs []primitive.ObjectID) (*mongo.UpdateResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var existing Guest
+	err := s.guestCollection.FindOne(ctx, trash.Live(bson.M{"_id": id})).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if existing.Version != version {
+		return nil, revision.ErrConflict
+	}
+	existing.InvitedEventIDs = eventIDs
+
+	update := bson.M{
+		"$set": bson.M{
+			"invited_event_ids": eventIDs,
+			"event_rsvps":       keepInvitedRSVPs(existing),
+			"updated_at":        revision.Now(),
+		},
+	}
+	return s.updateAt(ctx, id, existing.Version, revision.Bump(update))
+}
+
+// SetEventRSVP records or replaces the answer of the guest at version for one event
+func (s *MongoStore) SetEventRSVP(ctx context.Context, id primitive.ObjectID, version int64, rsvp EventRSVP) (*mongo.UpdateResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	var existing Guest
+	err := s.guestCollection.FindOne(ctx, trash.Live(bson.M{"_id": id})).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if existing.Version != version {
+		return nil, revision.ErrConflict
+	}
+	if err := NormalizeEventRSVP(existing, &rsvp); err != nil {
+		return nil, err
+	}
+
+	update := revision.Bump(bson.M{"$set": bson.M{"event_rsvps": withEventRSVP(existing.EventRSVPs, rsvp), "updated_at": revision.Now()}})
+	return s.updateAt(ctx, id, existing.Version, update)
+}
+
+// updateAt applies update to the live guest at version
+func (s *MongoStore) updateAt(ctx context.Context, id primitive.ObjectID, version int64, update bson.M) (*mongo.UpdateResult, error) {
+	result, err := s.guestCollection.UpdateOne(ctx, revision.Match(trash.Live(bson.M{"_id": id}), version), update)
+	if err != nil {
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		// The guest was read at version, so another request changed or deleted it in between
+		return nil, revision.ErrConflict
+	}
+	return result, nil
+}
+
+// RemoveEvent drops a deleted event's answers from every guest. The ID stays in
+// invited_event_ids so a guest invited only to that event is not suddenly invited to all of them.
+func (s *MongoStore) RemoveEvent(ctx context.Context, eventID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err := s.guestCollection.UpdateMany(ctx,
+		bson.M{"event_rsvps.event_id": eventID},
+		revision.Bump(bson.M{"$pull": bson.M{"event_rsvps": bson.M{"event_id": eventID}}, "$set": bson.M{"updated_at": revision.Now()}}),
+	)
+	return err
+}
+
+// GetClientStats summarizes a client's RSVPs with a single aggregation over the guest collection
+func (s *MongoStore) GetClientStats(ctx context.Context, clientID primitive.ObjectID, loc *time.Location) (*Stats, error) {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+
+	answered := bson.M{"$in": bson.A{"$confirmation", answeredStatuses}}
+	// Guests who answered before responded_at existed fall back to their insertion time
+	answeredAt := bson.M{"$ifNull": bson.A{"$responded_at", bson.M{"$toDate": "$_id"}}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: trash.Live(bson.M{"client_id": clientID})}},
+		{{Key: "$facet", Value: bson.M{
+			"by_status": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":        "$confirmation",
+					"count":      bson.M{"$sum": 1},
+					"head_count": bson.M{"$sum": "$party_size"},
+				}},
+			},
+			"invitees": bson.A{
+				bson.M{"$match": bson.M{"invitation_token": bson.M{"$exists": true}}},
+				bson.M{"$group": bson.M{
+					"_id":       nil,
+					"invited":   bson.M{"$sum": 1},
+					"responded": bson.M{"$sum": bson.M{"$cond": bson.A{answered, 1, 0}}},
+				}},
+			},
+			"timeline": bson.A{
+				bson.M{"$match": bson.M{"confirmation": bson.M{"$in": answeredStatuses}}},
+				bson.M{"$group": bson.M{
+					"_id": bson.M{"$dateToString": bson.M{
+						"format":   "%Y-%m-%d",
+						"date":     answeredAt,
+						"timezone": loc.String(),
+					}},
+					"responses": bson.M{"$sum": 1},
+					"attending": bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$confirmation", StatusAttending}}, 1, 0}}},
+					"head_count": bson.M{"$sum": bson.M{"$cond": bson.A{
+						bson.M{"$eq": bson.A{"$confirmation", StatusAttending}}, "$party_size", 0,
+					}}},
+				}},
+				bson.M{"$sort": bson.M{"_id": 1}},
+			},
+		}}},
+	}
+
+	cursor, err := s.guestCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var facets []struct {
+		ByStatus []struct {
+			Status    ConfirmationStatus `bson:"_id"`
+			Count     int                `bson:"count"`
+			HeadCount int                `bson:"head_count"`
+		} `bson:"by_status"`
+		Invitees []struct {
+			Invited   int `bson:"invited"`
+			Responded int `bson:"responded"`
+		} `bson:"invitees"`
+		Timeline []DailyResponses `bson:"timeline"`
+	}
+	if err := cursor.All(ctx, &facets); err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{ClientID: clientID, ByStatus: map[ConfirmationStatus]int{}}
+	if len(facets) > 0 {
+		for _, bucket := range facets[0].ByStatus {
+			stats.TotalGuests += bucket.Count
+			stats.ByStatus[bucket.Status] += bucket.Count
+			switch bucket.Status {
+			case StatusAttending:
+				stats.HeadCount += bucket.HeadCount
+			case StatusMaybe:
+				stats.MaybeHeadCount += bucket.HeadCount
+			}
+		}
+		if len(facets[0].Invitees) > 0 {
+			stats.InvitedGuests = facets[0].Invitees[0].Invited
+			stats.RespondedInvitees = facets[0].Invitees[0].Responded
+		}
+		stats.Timeline = facets[0].Timeline
+	}
+	stats.finish()
+	return stats, nil
+}
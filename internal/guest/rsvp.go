@@ -0,0 +1,145 @@
+package guest
+
+import (
+	"deili-backend/internal/apperror"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ConfirmationStatus is a guest's answer to the invitation
+type ConfirmationStatus string
+
+const (
+	StatusPending      ConfirmationStatus = "pending"
+	StatusAttending    ConfirmationStatus = "attending"
+	StatusNotAttending ConfirmationStatus = "not_attending"
+	StatusMaybe        ConfirmationStatus = "maybe"
+)
+
+// DefaultMaxPartySize applies to guests whose invitee record sets no explicit maximum
+const DefaultMaxPartySize = 2
+
+// ErrInvalidRSVP is wrapped by every RSVP validation failure
+var ErrInvalidRSVP = errors.New("invalid RSVP")
+
+// invalidRSVP reports a problem with one RSVP field as a validation error wrapping ErrInvalidRSVP
+func invalidRSVP(field, format string, args ...any) error {
+	problem := fmt.Sprintf(format, args...)
+	return apperror.Validation("%v: %s", ErrInvalidRSVP, problem).WithField(field, problem).Wrap(ErrInvalidRSVP)
+}
+
+// Valid reports whether s is one of the known statuses
+func (s ConfirmationStatus) Valid() bool {
+	switch s {
+	case StatusPending, StatusAttending, StatusNotAttending, StatusMaybe:
+		return true
+	}
+	return false
+}
+
+// ParseConfirmationStatus accepts a status case-insensitively; an empty value means pending
+func ParseConfirmationStatus(value string) (ConfirmationStatus, error) {
+	status := ConfirmationStatus(strings.ToLower(strings.TrimSpace(value)))
+	if status == "" {
+		return StatusPending, nil
+	}
+	if !status.Valid() {
+		return "", invalidRSVP("confirmation", "confirmation must be one of pending, attending, not_attending, maybe")
+	}
+	return status, nil
+}
+
+// legacyConfirmations maps the free-text answers stored before confirmation was an enum, in
+// English and Indonesian, to the status they meant
+var legacyConfirmations = map[string]ConfirmationStatus{
+	"yes": StatusAttending, "y": StatusAttending, "ya": StatusAttending, "iya": StatusAttending,
+	"hadir": StatusAttending, "akan hadir": StatusAttending, "coming": StatusAttending,
+	"will attend": StatusAttending, "attend": StatusAttending, "accepted": StatusAttending,
+	"confirmed": StatusAttending, "true": StatusAttending,
+	"no": StatusNotAttending, "n": StatusNotAttending, "tidak": StatusNotAttending,
+	"tidak hadir": StatusNotAttending, "not attending": StatusNotAttending, "not coming": StatusNotAttending,
+	"cannot attend": StatusNotAttending, "declined": StatusNotAttending, "false": StatusNotAttending,
+	"mungkin": StatusMaybe, "ragu": StatusMaybe, "ragu-ragu": StatusMaybe, "belum tahu": StatusMaybe,
+	"not sure": StatusMaybe, "unsure": StatusMaybe, "tentative": StatusMaybe,
+}
+
+// LegacyConfirmationStatus converts a confirmation stored as free text to a status. Answers
+// that cannot be read as one are pending, so the couple asks the guest again.
+func LegacyConfirmationStatus(value string) ConfirmationStatus {
+	normalized := strings.Join(strings.Fields(strings.ToLower(value)), " ")
+	if status := ConfirmationStatus(strings.ReplaceAll(normalized, " ", "_")); status.Valid() {
+		return status
+	}
+	if status, ok := legacyConfirmations[normalized]; ok {
+		return status
+	}
+	return StatusPending
+}
+
+// EffectiveMaxPartySize is the largest party this guest may bring, including themselves
+func (g Guest) EffectiveMaxPartySize() int {
+	if g.MaxPartySize > 0 {
+		return g.MaxPartySize
+	}
+	return DefaultMaxPartySize
+}
+
+// normalizeRSVP validates the RSVP fields of g against maxPartySize and fills in defaults:
+// guests who are coming count at least themselves, guests who are not have no party.
+func normalizeRSVP(g *Guest, maxPartySize int) error {
+	status, err := ParseConfirmationStatus(string(g.Confirmation))
+	if err != nil {
+		return err
+	}
+	g.Confirmation = status
+
+	if g.MaxPartySize < 0 {
+		return invalidRSVP("max_party_size", "max party size cannot be negative")
+	}
+	if g.PartySize < 0 {
+		return invalidRSVP("party_size", "party size cannot be negative")
+	}
+
+	plusOnes := make([]string, 0, len(g.PlusOnes))
+	for _, name := range g.PlusOnes {
+		if name = strings.TrimSpace(name); name != "" {
+			plusOnes = append(plusOnes, name)
+		}
+	}
+
+	switch status {
+	case StatusAttending, StatusMaybe:
+		if g.PartySize == 0 {
+			g.PartySize = 1 + len(plusOnes)
+		}
+		if g.PartySize > maxPartySize {
+			return invalidRSVP("party_size", "party size %d exceeds the maximum of %d", g.PartySize, maxPartySize)
+		}
+		if len(plusOnes) > g.PartySize-1 {
+			return invalidRSVP("plus_ones", "%d plus-one names given for a party of %d", len(plusOnes), g.PartySize)
+		}
+		g.PlusOnes = plusOnes
+	default:
+		g.PartySize = 0
+		g.PlusOnes = nil
+	}
+	return nil
+}
+
+// validateUpdate checks a guest about to replace the stored fields covered by Patch. The RSVP is
+// checked against the party size limit of the update itself, which carries over the stored one.
+func validateUpdate(g *Guest) error {
+	if g.ClientID.IsZero() {
+		return apperror.InvalidField("client_id", "cannot be zero")
+	}
+	if g.Phone != "" {
+		phone, err := NormalizePhone(g.Phone)
+		if err != nil {
+			return apperror.InvalidField("phone", "%v", err)
+		}
+		g.Phone = phone
+	}
+	g.Group = strings.TrimSpace(g.Group)
+	return normalizeRSVP(g, g.EffectiveMaxPartySize())
+}
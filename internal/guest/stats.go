@@ -0,0 +1,78 @@
+package guest
+
+import (
+	"deili-backend/internal/revision"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Stats summarizes the RSVPs of one client
+type Stats struct {
+	ClientID primitive.ObjectID `json:"client_id"`
+
+	// TotalGuests counts every guest record: pre-registered invitees and walk-in RSVPs alike
+	TotalGuests int                        `json:"total_guests"`
+	ByStatus    map[ConfirmationStatus]int `json:"by_status"`
+
+	// HeadCount is the number of people attending, plus-ones included; MaybeHeadCount is the upside
+	HeadCount      int `json:"head_count"`
+	MaybeHeadCount int `json:"maybe_head_count"`
+
+	// InvitedGuests are the pre-registered invitees; ResponseRate is the share of them who answered
+	InvitedGuests     int     `json:"invited_guests"`
+	RespondedInvitees int     `json:"responded_invitees"`
+	ResponseRate      float64 `json:"response_rate"`
+
+	Timeline []DailyResponses `json:"timeline"`
+}
+
+// DailyResponses counts the answers received on one calendar day
+type DailyResponses struct {
+	Date      string `json:"date" bson:"_id"`
+	Responses int    `json:"responses" bson:"responses"`
+	Attending int    `json:"attending" bson:"attending"`
+	HeadCount int    `json:"head_count" bson:"head_count"`
+}
+
+// answeredStatuses are the statuses that count as a response
+var answeredStatuses = []ConfirmationStatus{StatusAttending, StatusNotAttending, StatusMaybe}
+
+// hasAnswered reports whether the guest has given a response
+func (g Guest) hasAnswered() bool {
+	for _, s := range answeredStatuses {
+		if g.Confirmation == s {
+			return true
+		}
+	}
+	return false
+}
+
+// respondedAt keeps the time of the previous answer unless the answer changed
+func respondedAt(status, previous ConfirmationStatus, previousAt time.Time) time.Time {
+	if status == StatusPending {
+		return time.Time{}
+	}
+	if status == previous && !previousAt.IsZero() {
+		return previousAt
+	}
+	return revision.Now()
+}
+
+// finish fills in the derived fields once the counts are known
+func (s *Stats) finish() {
+	if s.ByStatus == nil {
+		s.ByStatus = map[ConfirmationStatus]int{}
+	}
+	for _, status := range []ConfirmationStatus{StatusPending, StatusAttending, StatusNotAttending, StatusMaybe} {
+		if _, ok := s.ByStatus[status]; !ok {
+			s.ByStatus[status] = 0
+		}
+	}
+	if s.InvitedGuests > 0 {
+		s.ResponseRate = float64(s.RespondedInvitees) / float64(s.InvitedGuests)
+	}
+	if s.Timeline == nil {
+		s.Timeline = []DailyResponses{}
+	}
+}
@@ -0,0 +1,68 @@
+// Package idempotency lets callers retry POST requests safely. A request sent with an
+// Idempotency-Key header is processed once; its response is stored for a while and served
+// again to retries carrying the same key instead of repeating the work.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Header carries the caller's idempotency key
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set on responses served from a stored result
+const ReplayedHeader = "Idempotent-Replayed"
+
+// lockTimeout is how long a request may hold a key before it is presumed lost, e.g. because
+// the server stopped mid-request, and a retry may take the key over
+const lockTimeout = time.Minute
+
+// State is how far the request that claimed a key got
+type State string
+
+const (
+	StateInProgress State = "in_progress"
+	StateCompleted  State = "completed"
+)
+
+// ErrNotFound is returned when completing or releasing a key nobody holds
+var ErrNotFound = errors.New("idempotency key not found")
+
+// Response is a stored response replayed to retries
+type Response struct {
+	Status      int    `bson:"status"`
+	ContentType string `bson:"content_type,omitempty"`
+	Location    string `bson:"location,omitempty"`
+	Body        []byte `bson:"body"`
+}
+
+// Record is one claimed idempotency key
+type Record struct {
+	// Key scopes the caller's key to the caller and route, see scopedKey
+	Key string `bson:"key"`
+	// Fingerprint is a hash of the request body, so a key reused for a different request is caught
+	Fingerprint string    `bson:"fingerprint"`
+	State       State     `bson:"state"`
+	Response    *Response `bson:"response,omitempty"`
+	LockedAt    time.Time `bson:"locked_at"`
+	// ExpiresAt is when the record is forgotten and the key may be used again
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// stale reports whether rec is held by a request that has presumably been lost
+func (rec Record) stale(now time.Time) bool {
+	return rec.State == StateInProgress && now.Sub(rec.LockedAt) >= lockTimeout
+}
+
+// Store persists idempotency records
+type Store interface {
+	// Begin claims rec.Key. It returns nil when the caller now holds the key and must Complete
+	// or Release it, or the live record already stored under the key.
+	Begin(ctx context.Context, rec Record) (*Record, error)
+	// Complete stores the response of the request holding key
+	Complete(ctx context.Context, key string, resp Response) error
+	// Release forgets key so a retry is processed again, e.g. after a server error
+	Release(ctx context.Context, key string) error
+}
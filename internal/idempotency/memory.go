@@ -0,0 +1,67 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-memory Store, safe for concurrent use
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+	now     func() time.Time
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore returns an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record), now: time.Now}
+}
+
+// Begin claims rec.Key unless a live record holds it; expired records are dropped on the way
+func (s *MemoryStore) Begin(ctx context.Context, rec Record) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, existing := range s.records {
+		if !now.Before(existing.ExpiresAt) {
+			delete(s.records, key)
+		}
+	}
+	if existing, ok := s.records[rec.Key]; ok && !existing.stale(now) {
+		return &existing, nil
+	}
+	rec.State, rec.Response = StateInProgress, nil
+	s.records[rec.Key] = rec
+	return nil, nil
+}
+
+// Complete stores resp on the in-progress record for key
+func (s *MemoryStore) Complete(ctx context.Context, key string, resp Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[key]
+	if !ok || rec.State != StateInProgress {
+		return ErrNotFound
+	}
+	rec.State, rec.Response = StateCompleted, &resp
+	s.records[key] = rec
+	return nil
+}
+
+// Release deletes the in-progress record for key
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[key]
+	if !ok || rec.State != StateInProgress {
+		return ErrNotFound
+	}
+	delete(s.records, key)
+	return nil
+}
@@ -0,0 +1,195 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"deili-backend/internal/apperror"
+	"deili-backend/internal/auth"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// maxKeyLength bounds keys supplied by callers
+	maxKeyLength = 255
+	// maxBodyBytes bounds the request bodies read to fingerprint a request; every route sets
+	// its own lower limit
+	maxBodyBytes = 8 << 20
+	// maxStoredBytes bounds the responses kept for replay; bigger ones are not stored and a
+	// retry is processed again
+	maxStoredBytes = 1 << 20
+)
+
+// Middleware makes POST requests carrying an Idempotency-Key header safe to retry. The first
+// request with a key is processed and its response kept for ttl; retries get that response
+// back, marked with Idempotent-Replayed, while a retry racing the first request gets 409.
+// Server errors and rate limited responses are not kept, so those can be retried for real.
+// It must run after auth.Middleware, since keys are scoped to the caller.
+func Middleware(store Store, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(Header)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !validKey(key) {
+				apperror.Write(w, apperror.InvalidField(Header, "must be at most %d printable characters", maxKeyLength))
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					apperror.Write(w, apperror.New(apperror.CodePayloadTooLarge, "request body exceeds %d bytes", tooLarge.Limit))
+					return
+				}
+				apperror.Write(w, apperror.Validation("error reading request body: %v", err))
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			now := time.Now().UTC()
+			rec := Record{
+				Key:         scopedKey(r, key),
+				Fingerprint: hash([]byte(r.Header.Get("Content-Type")), body),
+				LockedAt:    now,
+				ExpiresAt:   now.Add(ttl),
+			}
+			existing, err := store.Begin(r.Context(), rec)
+			if err != nil {
+				apperror.Write(w, err)
+				return
+			}
+			if existing != nil {
+				replay(w, *existing, rec.Fingerprint)
+				return
+			}
+
+			rw := &recorder{ResponseWriter: w, status: http.StatusOK}
+			// The result is saved even when the caller hung up, which is when it retries
+			ctx := context.WithoutCancel(r.Context())
+			finished := false
+			defer func() {
+				// A panicking handler leaves the key free for a retry
+				if !finished {
+					release(ctx, store, rec.Key)
+				}
+			}()
+			next.ServeHTTP(rw, r)
+			finished = true
+
+			if rw.status >= http.StatusInternalServerError || rw.status == http.StatusTooManyRequests || rw.overflow {
+				release(ctx, store, rec.Key)
+				return
+			}
+			resp := Response{
+				Status:      rw.status,
+				ContentType: w.Header().Get("Content-Type"),
+				Location:    w.Header().Get("Location"),
+				Body:        rw.body.Bytes(),
+			}
+			if err := store.Complete(ctx, rec.Key, resp); err != nil {
+				log.Printf("Error storing idempotent response: %v", err)
+			}
+		})
+	}
+}
+
+// replay answers a retry from the record stored under its key
+func replay(w http.ResponseWriter, rec Record, fingerprint string) {
+	if rec.Fingerprint != fingerprint {
+		apperror.Write(w, apperror.InvalidField(Header, "was already used for a different request"))
+		return
+	}
+	if rec.State != StateCompleted || rec.Response == nil {
+		conflict := apperror.Conflict("a request with this %s is still being processed", Header)
+		conflict.RetryAfter = time.Second
+		apperror.Write(w, conflict)
+		return
+	}
+
+	resp := rec.Response
+	if resp.ContentType != "" {
+		w.Header().Set("Content-Type", resp.ContentType)
+	}
+	if resp.Location != "" {
+		w.Header().Set("Location", resp.Location)
+	}
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(resp.Status)
+	w.Write(resp.Body)
+}
+
+// release frees key after a response that must not be replayed
+func release(ctx context.Context, store Store, key string) {
+	if err := store.Release(ctx, key); err != nil && !errors.Is(err, ErrNotFound) {
+		log.Printf("Error releasing idempotency key: %v", err)
+	}
+}
+
+// scopedKey ties the caller's key to the caller and the route, so two callers picking the same
+// key, or one key sent to two endpoints, never share a response. It is hashed to bound its size.
+func scopedKey(r *http.Request, key string) string {
+	p := auth.FromContext(r.Context())
+	return hash([]byte(p.Role), []byte(p.Subject), []byte(r.URL.Path), []byte(key))
+}
+
+// hash returns the hex SHA-256 of the parts, separated so they cannot run into each other
+func hash(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// validKey accepts printable ASCII keys such as UUIDs
+func validKey(key string) bool {
+	if len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < ' ' || key[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// recorder passes a response through while keeping a copy for replay
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	// overflow is set once the body outgrows maxStoredBytes
+	overflow bool
+}
+
+func (rw *recorder) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status, rw.wroteHeader = status, true
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recorder) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	if !rw.overflow {
+		if rw.body.Len()+len(b) > maxStoredBytes {
+			rw.overflow = true
+			rw.body.Reset()
+		} else {
+			rw.body.Write(b)
+		}
+	}
+	return rw.ResponseWriter.Write(b)
+}
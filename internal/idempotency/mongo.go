@@ -0,0 +1,98 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoStore is a Store backed by the MongoDB idempotency_keys collection
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+var _ Store = (*MongoStore)(nil)
+
+// NewMongoStore returns a store using the idempotency_keys collection of the given database. Its
+// unique key and TTL indexes are created by the migrations, see package migrate.
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{collection: db.Collection("idempotency_keys")}
+}
+
+// Begin inserts rec as in progress. When the key is taken, a record that is stale or expired
+// but not yet removed by the TTL monitor is taken over; otherwise the stored record is returned.
+func (s *MongoStore) Begin(ctx context.Context, rec Record) (*Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	rec.State, rec.Response = StateInProgress, nil
+	// The stored record can disappear between the insert and the lookup when its holder
+	// releases it, so try again a few times
+	for attempt := 0; attempt < 3; attempt++ {
+		_, err := s.collection.InsertOne(ctx, rec)
+		if err == nil {
+			return nil, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		takeOver := bson.M{"key": rec.Key, "$or": bson.A{
+			bson.M{"state": StateInProgress, "locked_at": bson.M{"$lte": rec.LockedAt.Add(-lockTimeout)}},
+			bson.M{"expires_at": bson.M{"$lte": rec.LockedAt}},
+		}}
+		err = s.collection.FindOneAndReplace(ctx, takeOver, rec).Err()
+		if err == nil {
+			return nil, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+
+		var existing Record
+		err = s.collection.FindOne(ctx, bson.M{"key": rec.Key}).Decode(&existing)
+		if err == nil {
+			return &existing, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+	}
+	return nil, errors.New("idempotency key kept changing hands")
+}
+
+// Complete stores resp on the in-progress record for key
+func (s *MongoStore) Complete(ctx context.Context, key string, resp Response) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := s.collection.UpdateOne(ctx,
+		bson.M{"key": key, "state": StateInProgress},
+		bson.M{"$set": bson.M{"state": StateCompleted, "response": resp}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Release deletes the in-progress record for key
+func (s *MongoStore) Release(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := s.collection.DeleteOne(ctx, bson.M{"key": key, "state": StateInProgress})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+// Package listing implements cursor-based pagination, sorting and name search shared by the
+// list endpoints. Pages are keyset-paginated on (sort field, _id), and the position is handed
+// to clients as an opaque page token.
+package listing
+
+import (
+	"deili-backend/internal/apperror"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SortField is a field list results can be ordered by
+type SortField string
+
+const (
+	// SortCreated orders by creation time, which the ObjectID embeds
+	SortCreated SortField = "created_at"
+	// SortName orders case-insensitively by name
+	SortName SortField = "name"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// ErrInvalidQuery is wrapped by every invalid listing parameter, including bad page tokens
+var ErrInvalidQuery = errors.New("invalid list query")
+
+// InvalidParam reports a problem with one query parameter as a validation error wrapping ErrInvalidQuery
+func InvalidParam(param, format string, args ...any) error {
+	problem := fmt.Sprintf(format, args...)
+	return apperror.Validation("%v: %s", ErrInvalidQuery, problem).WithField(param, problem).Wrap(ErrInvalidQuery)
+}
+
+// nameCollation makes Mongo compare names case-insensitively, matching strings.ToLower in memory
+var nameCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// Query describes one page of a list request
+type Query struct {
+	Limit      int
+	SortBy     SortField
+	Descending bool
+	// Search matches names containing the text, ignoring case
+	Search    string
+	PageToken string
+
+	cursor *cursor
+}
+
+// Page is one page of results with the total number of matches across all pages
+type Page[T any] struct {
+	Items         []T    `json:"items"`
+	Total         int64  `json:"total"`
+	NextPageToken string `json:"next_page_token,omitempty"`
+}
+
+// cursor is the decoded page token: the sort key of the last item already returned
+type cursor struct {
+	SortBy     SortField          `json:"s"`
+	Descending bool               `json:"d"`
+	Name       string             `json:"n,omitempty"`
+	ID         primitive.ObjectID `json:"i"`
+}
+
+// Normalize applies defaults and validates the query, decoding its page token
+func (q *Query) Normalize() error {
+	if q.Limit == 0 {
+		q.Limit = DefaultLimit
+	}
+	if q.Limit < 1 || q.Limit > MaxLimit {
+		return InvalidParam("limit", "limit must be between 1 and %d", MaxLimit)
+	}
+	switch q.SortBy {
+	case "":
+		q.SortBy = SortCreated
+	case SortCreated, SortName:
+	default:
+		return InvalidParam("sort", "sort must be %q or %q", SortCreated, SortName)
+	}
+	q.Search = strings.TrimSpace(q.Search)
+
+	q.cursor = nil
+	if q.PageToken == "" {
+		return nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(q.PageToken)
+	if err != nil {
+		return InvalidParam("page_token", "malformed page_token")
+	}
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.ID.IsZero() {
+		return InvalidParam("page_token", "malformed page_token")
+	}
+	if c.SortBy != q.SortBy || c.Descending != q.Descending {
+		return InvalidParam("page_token", "page_token was issued for a different sort order")
+	}
+	q.cursor = &c
+	return nil
+}
+
+// MongoFilter extends base with the search condition and, on later pages, the keyset condition
+func (q Query) MongoFilter(base bson.M) bson.M {
+	filter := q.CountFilter(base)
+	if q.cursor == nil {
+		return filter
+	}
+
+	op := "$gt"
+	if q.Descending {
+		op = "$lt"
+	}
+	var after bson.M
+	if q.SortBy == SortName {
+		after = bson.M{"$or": bson.A{
+			bson.M{"name": bson.M{op: q.cursor.Name}},
+			bson.M{"name": q.cursor.Name, "_id": bson.M{op: q.cursor.ID}},
+		}}
+	} else {
+		after = bson.M{"_id": bson.M{op: q.cursor.ID}}
+	}
+	return bson.M{"$and": bson.A{filter, after}}
+}
+
+// CountFilter extends base with the search condition only, for counting every match
+func (q Query) CountFilter(base bson.M) bson.M {
+	filter := bson.M{}
+	for k, v := range base {
+		filter[k] = v
+	}
+	if q.Search != "" {
+		filter["name"] = bson.M{"$regex": regexp.QuoteMeta(q.Search), "$options": "i"}
+	}
+	return filter
+}
+
+// FindOptions sorts the query and fetches one extra item to learn whether another page exists
+func (q Query) FindOptions() *options.FindOptions {
+	dir := 1
+	if q.Descending {
+		dir = -1
+	}
+	opts := options.Find().SetLimit(int64(q.Limit) + 1)
+	if q.SortBy == SortName {
+		opts.SetSort(bson.D{{Key: "name", Value: dir}, {Key: "_id", Value: dir}}).SetCollation(nameCollation)
+	} else {
+		opts.SetSort(bson.D{{Key: "_id", Value: dir}})
+	}
+	return opts
+}
+
+// CountOptions matches the collation used by FindOptions
+func (q Query) CountOptions() *options.CountOptions {
+	opts := options.Count()
+	if q.SortBy == SortName {
+		opts.SetCollation(nameCollation)
+	}
+	return opts
+}
+
+// NewPage trims the extra item fetched by FindOptions and issues the next page token.
+// key returns an item's name and ID.
+func NewPage[T any](items []T, total int64, q Query, key func(T) (string, primitive.ObjectID)) Page[T] {
+	page := Page[T]{Items: items, Total: total}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if len(items) <= q.Limit {
+		return page
+	}
+
+	page.Items = items[:q.Limit]
+	name, id := key(page.Items[q.Limit-1])
+	c := cursor{SortBy: q.SortBy, Descending: q.Descending, ID: id}
+	if q.SortBy == SortName {
+		c.Name = name
+	}
+	raw, _ := json.Marshal(c)
+	page.NextPageToken = base64.RawURLEncoding.EncodeToString(raw)
+	return page
+}
+
+// Paginate applies the query to an in-memory slice the same way the Mongo helpers do, for the
+// in-memory stores. items must already be filtered by everything except the search.
+func Paginate[T any](items []T, q Query, key func(T) (string, primitive.ObjectID)) Page[T] {
+	search := strings.ToLower(q.Search)
+	matched := make([]T, 0, len(items))
+	for _, item := range items {
+		name, _ := key(item)
+		if search == "" || strings.Contains(strings.ToLower(name), search) {
+			matched = append(matched, item)
+		}
+	}
+
+	less := func(a, b T) bool {
+		nameA, idA := key(a)
+		nameB, idB := key(b)
+		if q.SortBy == SortName {
+			if la, lb := strings.ToLower(nameA), strings.ToLower(nameB); la != lb {
+				return la < lb
+			}
+		}
+		return idA.Hex() < idB.Hex()
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if q.Descending {
+			return less(matched[j], matched[i])
+		}
+		return less(matched[i], matched[j])
+	})
+
+	total := int64(len(matched))
+	start := 0
+	if q.cursor != nil {
+		start = sort.Search(len(matched), func(i int) bool {
+			name, id := key(matched[i])
+			return afterCursor(q, name, id)
+		})
+	}
+	end := min(start+q.Limit+1, len(matched))
+	return NewPage(matched[start:end], total, q, key)
+}
+
+// afterCursor reports whether an item sorts after the page token's position
+func afterCursor(q Query, name string, id primitive.ObjectID) bool {
+	c := q.cursor
+	cmp := 0
+	if q.SortBy == SortName {
+		cmp = strings.Compare(strings.ToLower(name), strings.ToLower(c.Name))
+	}
+	if cmp == 0 {
+		cmp = strings.Compare(id.Hex(), c.ID.Hex())
+	}
+	if q.Descending {
+		return cmp < 0
+	}
+	return cmp > 0
+}
@@ -0,0 +1,60 @@
+// Package maintenance holds database checks and cleanup jobs that run outside the request path
+package maintenance
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// dependentCollections are the collections whose documents belong to a client via client_id
+var dependentCollections = []string{"guests", "events"}
+
+// Orphans counts the documents of one collection pointing at a client that no longer exists
+type Orphans struct {
+	Collection string             `json:"collection"`
+	ClientID   primitive.ObjectID `json:"client_id"`
+	Count      int64              `json:"count"`
+}
+
+// FindOrphans reports, per collection and missing client, the documents whose client_id does
+// not match any client. Documents without a client_id are reported under the zero ID.
+func FindOrphans(ctx context.Context, db *mongo.Database) ([]Orphans, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	// Group first so the lookup runs once per client rather than once per document
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$client_id", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "clients",
+			"localField":   "_id",
+			"foreignField": "_id",
+			"as":           "client",
+		}}},
+		{{Key: "$match", Value: bson.M{"client": bson.M{"$size": 0}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}}}},
+	}
+
+	var report []Orphans
+	for _, name := range dependentCollections {
+		cursor, err := db.Collection(name).Aggregate(ctx, pipeline)
+		if err != nil {
+			return nil, err
+		}
+		var groups []struct {
+			ClientID primitive.ObjectID `bson:"_id"`
+			Count    int64              `bson:"count"`
+		}
+		if err := cursor.All(ctx, &groups); err != nil {
+			return nil, err
+		}
+		for _, g := range groups {
+			report = append(report, Orphans{Collection: name, ClientID: g.ClientID, Count: g.Count})
+		}
+	}
+	return report, nil
+}
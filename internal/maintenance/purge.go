@@ -0,0 +1,75 @@
+package maintenance
+
+import (
+	"context"
+	"deili-backend/internal/client"
+	"deili-backend/internal/event"
+	"deili-backend/internal/guest"
+	"log"
+	"time"
+)
+
+// PurgeReport counts what one purge permanently deleted
+type PurgeReport struct {
+	Clients int64
+	Guests  int64
+	Events  int64
+}
+
+// Purger permanently deletes clients and guests that have been in the trash for longer than
+// Retention, together with the events of the purged clients
+type Purger struct {
+	Clients   client.ClientStore
+	Guests    guest.GuestStore
+	Events    event.EventStore
+	Retention time.Duration
+}
+
+// Purge deletes everything trashed more than Retention ago
+func (p *Purger) Purge(ctx context.Context) (PurgeReport, error) {
+	var report PurgeReport
+	cutoff := time.Now().Add(-p.Retention)
+
+	// Guests trashed along with a client share its deletion time, so they go in the same run
+	guests, err := p.Guests.PurgeGuests(ctx, cutoff)
+	if err != nil {
+		return report, err
+	}
+	report.Guests = guests
+
+	clientIDs, err := p.Clients.PurgeClients(ctx, cutoff)
+	if err != nil {
+		return report, err
+	}
+	report.Clients = int64(len(clientIDs))
+	for _, id := range clientIDs {
+		events, err := p.Events.DeleteEventsByClient(ctx, id)
+		if err != nil {
+			return report, err
+		}
+		report.Events += events.DeletedCount
+	}
+	return report, nil
+}
+
+// Run purges once every interval until ctx is cancelled, logging failures rather than stopping
+func (p *Purger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := p.Purge(ctx)
+		switch {
+		case err != nil:
+			log.Printf("Error purging the trash: %v", err)
+		case report != PurgeReport{}:
+			log.Printf("Purged %d clients, %d guests and %d events from the trash", report.Clients, report.Guests, report.Events)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,345 @@
+// Package migrate versions the database: indexes, schema validators and data backfills are
+// migrations applied once, in order, and recorded in the migrations collection so every
+// deployment knows which it still needs.
+package migrate
+
+import (
+	"context"
+	"deili-backend/internal/revision"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// lockID is the lock document every runner competes for
+	lockID = "migrations"
+	// lockTimeout is how long a lock is honored without being renewed; a runner that crashed
+	// mid-migration leaves its lock behind, and the next runner takes it over once it is this old
+	lockTimeout = 15 * time.Minute
+	// lockRenew is how often the runner holding the lock renews it, however long a migration runs
+	lockRenew = time.Minute
+	// lockPoll is how often a runner waiting for another one checks the lock again
+	lockPoll = 2 * time.Second
+	// namespaceNotFound is the server error code for a collection that does not exist
+	namespaceNotFound = 26
+	// indexNotFound is the server error code for dropping an index that does not exist
+	indexNotFound = 27
+)
+
+// errLockLost is returned when another process took over the lock while migrations were running,
+// which only happens when this one could not renew it for lockTimeout
+var errLockLost = errors.New("lost the migration lock to another process")
+
+// Migration is one versioned change to the database. Up must be safe to run again after it
+// failed halfway, since it is only recorded as applied once it returns nil.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// Record is a migration as stored once applied
+type Record struct {
+	Version     int       `bson:"_id" json:"version"`
+	Description string    `bson:"description" json:"description"`
+	AppliedAt   time.Time `bson:"applied_at" json:"applied_at"`
+	DurationMS  int64     `bson:"duration_ms" json:"duration_ms"`
+}
+
+// Status pairs a known migration with its record, which is nil while it is pending
+type Status struct {
+	Migration Migration
+	Applied   *Record
+}
+
+// Runner applies migrations to one database
+type Runner struct {
+	db         *mongo.Database
+	migrations []Migration
+	records    *mongo.Collection
+	locks      *mongo.Collection
+	// owner identifies this runner in the lock document, to tell who holds it
+	owner string
+}
+
+// NewRunner returns a runner for the given migrations, which must be sorted by version
+func NewRunner(db *mongo.Database, migrations []Migration) *Runner {
+	host, _ := os.Hostname()
+	return &Runner{
+		db:         db,
+		migrations: migrations,
+		records:    db.Collection("migrations"),
+		locks:      db.Collection("migration_locks"),
+		// Containers often share a PID, so the host name alone does not tell two runners apart
+		owner: fmt.Sprintf("%s/%d/%s", host, os.Getpid(), primitive.NewObjectID().Hex()),
+	}
+}
+
+// check rejects migration lists that would apply out of order
+func (r *Runner) check() error {
+	for i, m := range r.migrations {
+		if m.Version <= 0 || m.Up == nil {
+			return fmt.Errorf("migration %d (%s) needs a positive version and an Up function", m.Version, m.Description)
+		}
+		if i > 0 && m.Version <= r.migrations[i-1].Version {
+			return fmt.Errorf("migration %d is listed after migration %d", m.Version, r.migrations[i-1].Version)
+		}
+	}
+	return nil
+}
+
+// Status reports every known migration and whether it was applied
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, len(r.migrations))
+	for i, m := range r.migrations {
+		statuses[i] = Status{Migration: m}
+		if rec, ok := applied[m.Version]; ok {
+			statuses[i].Applied = &rec
+		}
+	}
+	return statuses, nil
+}
+
+// applied returns the records of the applied migrations by version
+func (r *Runner) applied(ctx context.Context) (map[int]Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cursor, err := r.records.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := make(map[int]Record, len(records))
+	for _, rec := range records {
+		applied[rec.Version] = rec
+	}
+	return applied, nil
+}
+
+// Up applies the pending migrations in order and returns the ones it applied. It holds the
+// migration lock meanwhile, so several instances starting together apply each migration once;
+// it stops at the first migration that fails.
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+	if err := r.check(); err != nil {
+		return nil, err
+	}
+	if err := r.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.unlock()
+
+	// Keep the lock for as long as the migrations take; losing it stops them
+	ctx, cancel := context.WithCancelCause(ctx)
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		r.heartbeat(ctx, cancel)
+	}()
+	defer func() {
+		cancel(nil)
+		<-heartbeatDone
+	}()
+
+	// Read the records only once locked, another instance may just have applied some
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range r.migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		log.Printf("Applying migration %d: %s", m.Version, m.Description)
+		started := time.Now()
+		if err := m.Up(ctx, r.db); err != nil {
+			if cause := context.Cause(ctx); errors.Is(cause, errLockLost) {
+				err = cause
+			}
+			return done, fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+		// Another runner that took the lock over may be applying the same migration
+		if held, err := r.renew(ctx); err != nil || !held {
+			if err == nil {
+				err = errLockLost
+			}
+			return done, fmt.Errorf("recording migration %d: %w", m.Version, err)
+		}
+		rec := Record{
+			Version:     m.Version,
+			Description: m.Description,
+			AppliedAt:   revision.Now(),
+			DurationMS:  time.Since(started).Milliseconds(),
+		}
+		if _, err := r.records.InsertOne(ctx, rec); err != nil {
+			return done, fmt.Errorf("recording migration %d: %w", m.Version, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// lock waits until this runner holds the migration lock or ctx is done
+func (r *Runner) lock(ctx context.Context) error {
+	for {
+		acquired, err := r.tryLock(ctx)
+		if err != nil || acquired {
+			return err
+		}
+		log.Printf("Waiting for another process to finish applying migrations")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for the migration lock: %w", ctx.Err())
+		case <-time.After(lockPoll):
+		}
+	}
+}
+
+// tryLock takes the lock when it is free or has expired
+func (r *Runner) tryLock(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	lock := bson.M{"_id": lockID, "owner": r.owner, "locked_at": now}
+	_, err := r.locks.InsertOne(ctx, lock)
+	if err == nil {
+		return true, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return false, err
+	}
+
+	expired := bson.M{"_id": lockID, "locked_at": bson.M{"$lte": now.Add(-lockTimeout)}}
+	err = r.locks.FindOneAndReplace(ctx, expired, lock).Err()
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	log.Printf("Took over an expired migration lock")
+	return true, nil
+}
+
+// heartbeat renews the lock every lockRenew until ctx is done, and cancels ctx with errLockLost
+// once another runner holds it. Failed renewals are retried; the lock only expires after
+// lockTimeout.
+func (r *Runner) heartbeat(ctx context.Context, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(lockRenew)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		held, err := r.renew(ctx)
+		if err != nil {
+			log.Printf("Error renewing the migration lock: %v", err)
+			continue
+		}
+		if !held {
+			log.Printf("Another process took over the migration lock")
+			cancel(errLockLost)
+			return
+		}
+	}
+}
+
+// renew moves the lock's locked_at forward and reports whether this runner still holds it
+func (r *Runner) renew(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	result, err := r.locks.UpdateOne(ctx, bson.M{"_id": lockID, "owner": r.owner}, bson.M{"$set": bson.M{"locked_at": time.Now().UTC()}})
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// unlock releases the lock if this runner still holds it
+func (r *Runner) unlock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := r.locks.DeleteOne(ctx, bson.M{"_id": lockID, "owner": r.owner}); err != nil {
+		log.Printf("Error releasing the migration lock: %v", err)
+	}
+}
+
+// createIndexes creates the indexes of one collection; indexes that already exist with the
+// same definition are left alone
+func createIndexes(ctx context.Context, db *mongo.Database, collection string, models []mongo.IndexModel) error {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	if _, err := db.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+		return fmt.Errorf("creating %s indexes: %w", collection, err)
+	}
+	return nil
+}
+
+// dropIndex drops the named index of collection, if it exists
+func dropIndex(ctx context.Context, collection *mongo.Collection, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	_, err := collection.Indexes().DropOne(ctx, name)
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && (cmdErr.Code == indexNotFound || cmdErr.Code == namespaceNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("dropping %s index %s: %w", collection.Name(), name, err)
+	}
+	return nil
+}
+
+// setValidator makes MongoDB check documents written to collection against schema, creating
+// the collection when it does not exist yet. Validation is moderate: documents that already
+// break the schema can still be updated, so a stray legacy record never blocks the API.
+func setValidator(ctx context.Context, db *mongo.Database, collection string, schema bson.M) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	validator := bson.M{"$jsonSchema": schema}
+	cmd := bson.D{
+		{Key: "collMod", Value: collection},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "moderate"},
+		{Key: "validationAction", Value: "error"},
+	}
+	err := db.RunCommand(ctx, cmd).Err()
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == namespaceNotFound {
+		opts := options.CreateCollection().SetValidator(validator).SetValidationLevel("moderate").SetValidationAction("error")
+		err = db.CreateCollection(ctx, collection, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("setting the %s validator: %w", collection, err)
+	}
+	return nil
+}
@@ -0,0 +1,384 @@
+package migrate
+
+import (
+	"context"
+	"deili-backend/config"
+	"deili-backend/internal/client"
+	"deili-backend/internal/guest"
+	"fmt"
+	"log"
+	"time"
+
+	"deili-backend/internal/trash"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All lists every migration in the order they apply. Applied migrations are never edited or
+// removed; a change to one is a new migration at the end of the list.
+var All = []Migration{
+	{Version: 1, Description: "create indexes", Up: createBaseIndexes},
+	{Version: 2, Description: "convert free-text guest confirmations to statuses", Up: backfillConfirmations},
+	{Version: 3, Description: "mark unmoderated guest messages as pending", Up: backfillMessageStatus},
+	{Version: 4, Description: "backfill created_at, updated_at and version", Up: backfillRevisions},
+	{Version: 5, Description: "validate clients, guests and events with JSON schemas", Up: setBaseValidators},
+	{Version: 6, Description: "make client slugs unique", Up: createSlugIndex},
+	{Version: 7, Description: "make custom domains unique", Up: createDomainIndex},
+	{Version: 8, Description: "reserve custom domains only once verified", Up: indexVerifiedHosts},
+	{Version: 9, Description: "count the seats taken at each event", Up: backfillSeatsTaken},
+	{Version: 10, Description: "moderate messages held by migration 3 by the message wall rules", Up: moderateLegacyMessages},
+}
+
+// nameCollation is the collation name sorting uses, see package listing; an index only serves
+// a sort with the same collation
+var nameCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// deletedOnly limits an index to documents in the trash, which is all the trash and purge
+// queries look at
+var deletedOnly = bson.M{"deleted_at": bson.M{"$exists": true}}
+
+// createBaseIndexes backs the queries the stores run and enforces the unique keys
+func createBaseIndexes(ctx context.Context, db *mongo.Database) error {
+	indexes := map[string][]mongo.IndexModel{
+		"clients": {
+			{Keys: bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("name").SetCollation(nameCollation)},
+			{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetName("deleted_at").SetPartialFilterExpression(deletedOnly)},
+		},
+		"guests": {
+			// Listing by creation time and streaming exports walk a client's guests by _id
+			{Keys: bson.D{{Key: "client_id", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("client_id")},
+			{Keys: bson.D{{Key: "client_id", Value: 1}, {Key: "name", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("client_id_name").SetCollation(nameCollation)},
+			// Only invitees have a token, so the index leaves every other guest out
+			{Keys: bson.D{{Key: "invitation_token", Value: 1}}, Options: options.Index().SetName("invitation_token_unique").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"invitation_token": bson.M{"$type": "string"}})},
+			{Keys: bson.D{{Key: "event_rsvps.event_id", Value: 1}}, Options: options.Index().SetName("event_rsvps_event_id")},
+			{Keys: bson.D{{Key: "deleted_at", Value: 1}}, Options: options.Index().SetName("deleted_at").SetPartialFilterExpression(deletedOnly)},
+		},
+		"events": {
+			{Keys: bson.D{{Key: "client_id", Value: 1}, {Key: "starts_at", Value: 1}}, Options: options.Index().SetName("client_id_starts_at")},
+		},
+		"audit_log": {
+			{Keys: bson.D{{Key: "client_id", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("client_id")},
+			{Keys: bson.D{{Key: "client_id", Value: 1}, {Key: "resource_id", Value: 1}, {Key: "_id", Value: 1}}, Options: options.Index().SetName("client_id_resource_id")},
+		},
+		"idempotency_keys": {
+			// Only one of several concurrent retries may claim a key; expired records are
+			// removed by the TTL monitor
+			{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetName("key_unique").SetUnique(true)},
+			{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0)},
+		},
+	}
+	for collection, models := range indexes {
+		if err := createIndexes(ctx, db, collection, models); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillConfirmations converts the free-text confirmations stored before confirmation was a
+// status, and gives attending guests the party of one the stores now require
+func backfillConfirmations(ctx context.Context, db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+	guests := db.Collection("guests")
+
+	statuses := bson.A{guest.StatusPending, guest.StatusAttending, guest.StatusNotAttending, guest.StatusMaybe}
+	// Couples typed a handful of answers, so convert per distinct answer rather than per guest
+	values, err := guests.Distinct(ctx, "confirmation", bson.M{"confirmation": bson.M{"$nin": statuses}})
+	if err != nil {
+		return err
+	}
+	for _, value := range values {
+		status := guest.LegacyConfirmationStatus(fmt.Sprint(value))
+		result, err := guests.UpdateMany(ctx, bson.M{"confirmation": value}, bson.M{"$set": bson.M{"confirmation": status}})
+		if err != nil {
+			return err
+		}
+		log.Printf("Converted confirmation %q to %s on %d guests", fmt.Sprint(value), status, result.ModifiedCount)
+	}
+	// Whatever is left has no usable answer at all
+	if _, err := guests.UpdateMany(ctx, bson.M{"confirmation": bson.M{"$nin": statuses}}, bson.M{"$set": bson.M{"confirmation": guest.StatusPending}}); err != nil {
+		return err
+	}
+
+	coming := bson.M{
+		"confirmation": bson.M{"$in": bson.A{guest.StatusAttending, guest.StatusMaybe}},
+		"$or":          bson.A{bson.M{"party_size": bson.M{"$exists": false}}, bson.M{"party_size": bson.M{"$lt": 1}}},
+	}
+	partyOfOne := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"party_size": bson.M{"$add": bson.A{1, bson.M{"$size": bson.M{"$ifNull": bson.A{"$plus_ones", bson.A{}}}}}},
+	}}}}
+	if _, err := guests.UpdateMany(ctx, coming, partyOfOne); err != nil {
+		return err
+	}
+	notComing := bson.M{"party_size": bson.M{"$exists": false}}
+	_, err = guests.UpdateMany(ctx, notComing, bson.M{"$set": bson.M{"party_size": 0}})
+	return err
+}
+
+// backfillMessageStatus gives messages written before moderation existed the pending status;
+// migration 10 approves the clean ones again
+func backfillMessageStatus(ctx context.Context, db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	filter := bson.M{"message": bson.M{"$nin": bson.A{"", nil}}, "message_status": bson.M{"$exists": false}}
+	_, err := db.Collection("guests").UpdateMany(ctx, filter, bson.M{"$set": bson.M{"message_status": guest.MessagePending}})
+	return err
+}
+
+// moderateLegacyMessages applies the rules new messages go through to the messages migration 3
+// held, so clean messages that were public before moderation existed are approved again. Those
+// are the pending messages without a hold reason: moderation records one for every message it
+// holds, and couples can only approve or hide.
+func moderateLegacyMessages(ctx context.Context, db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+	guests := db.Collection("guests")
+
+	filter := bson.M{"message_status": guest.MessagePending, "message_hold_reason": bson.M{"$exists": false}}
+	opts := options.Find().SetProjection(bson.M{"message": 1})
+	cursor, err := guests.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	approved := 0
+	for cursor.Next(ctx) {
+		var g guest.Guest
+		if err := cursor.Decode(&g); err != nil {
+			return err
+		}
+		g.ModerateMessage(guest.Guest{}, config.MessageBlocklist)
+		update := bson.M{"$set": bson.M{"message_status": g.MessageStatus}}
+		switch g.MessageStatus {
+		case guest.MessagePending:
+			update = bson.M{"$set": bson.M{"message_hold_reason": g.MessageHoldReason}}
+		case "":
+			// Blank messages have no status
+			update = bson.M{"$unset": bson.M{"message_status": ""}}
+		default:
+			approved++
+		}
+		_, err = guests.UpdateOne(ctx, bson.M{"_id": g.ID}, update)
+		if err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	log.Printf("Approved %d messages held by the message status backfill", approved)
+	return nil
+}
+
+// backfillRevisions stamps records stored before the stores kept timestamps and versions with
+// the time in their ObjectID and version 1
+func backfillRevisions(ctx context.Context, db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"created_at": bson.M{"$exists": false}},
+		bson.M{"updated_at": bson.M{"$exists": false}},
+		bson.M{"version": bson.M{"$exists": false}},
+	}}
+	// Stages run in order, so updated_at can fall back to the created_at set just before
+	stamp := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"created_at": bson.M{"$ifNull": bson.A{"$created_at", bson.M{"$toDate": "$_id"}}},
+			"version":    bson.M{"$ifNull": bson.A{"$version", 1}},
+		}}},
+		{{Key: "$set", Value: bson.M{"updated_at": bson.M{"$ifNull": bson.A{"$updated_at", "$created_at"}}}}},
+	}
+	for _, collection := range []string{"clients", "guests", "events"} {
+		result, err := db.Collection(collection).UpdateMany(ctx, filter, stamp)
+		if err != nil {
+			return fmt.Errorf("backfilling %s: %w", collection, err)
+		}
+		log.Printf("Backfilled timestamps and versions on %d %s", result.ModifiedCount, collection)
+	}
+	return nil
+}
+
+// backfillSeatsTaken sets seats_taken on every event to the party sizes of the guests
+// attending it. Guests trashed together with their client count too, since restoring the
+// client brings them back without taking their seats again.
+func backfillSeatsTaken(ctx context.Context, db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"event_rsvps.confirmation": guest.StatusAttending}}},
+		{{Key: "$lookup", Value: bson.M{"from": "clients", "localField": "client_id", "foreignField": "_id", "as": "client"}}},
+		{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{trash.Field: bson.M{"$exists": false}},
+			bson.M{"$expr": bson.M{"$eq": bson.A{"$" + trash.Field, bson.M{"$arrayElemAt": bson.A{"$client." + trash.Field, 0}}}}},
+		}}}},
+		{{Key: "$unwind", Value: "$event_rsvps"}},
+		{{Key: "$match", Value: bson.M{"event_rsvps.confirmation": guest.StatusAttending}}},
+		{{Key: "$group", Value: bson.M{"_id": "$event_rsvps.event_id", "seats": bson.M{"$sum": "$event_rsvps.party_size"}}}},
+	}
+	cursor, err := db.Collection("guests").Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	var counts []struct {
+		EventID primitive.ObjectID `bson:"_id"`
+		Seats   int                `bson:"seats"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return err
+	}
+
+	events := db.Collection("events")
+	if _, err := events.UpdateMany(ctx, bson.M{}, bson.M{"$set": bson.M{"seats_taken": 0}}); err != nil {
+		return err
+	}
+	for _, count := range counts {
+		if _, err := events.UpdateOne(ctx, bson.M{"_id": count.EventID}, bson.M{"$set": bson.M{"seats_taken": count.Seats}}); err != nil {
+			return err
+		}
+	}
+	log.Printf("Counted the seats taken at %d events", len(counts))
+	return nil
+}
+
+// JSON schema building blocks
+var (
+	schemaString   = bson.M{"bsonType": "string"}
+	schemaDate     = bson.M{"bsonType": "date"}
+	schemaObjectID = bson.M{"bsonType": "objectId"}
+	// Go ints are stored as int32 when they fit and int64 otherwise
+	schemaCount   = bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0}
+	schemaVersion = bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 1}
+	schemaStatus  = bson.M{"enum": bson.A{guest.StatusPending, guest.StatusAttending, guest.StatusNotAttending, guest.StatusMaybe}}
+)
+
+// setBaseValidators makes MongoDB refuse writes that break the rules the stores enforce, so a
+// bug or a manual edit cannot store a record the API would choke on
+func setBaseValidators(ctx context.Context, db *mongo.Database) error {
+	schemas := map[string]bson.M{
+		"clients": {
+			"bsonType": "object",
+			"required": bson.A{"name", "invitation_types", "created_at", "updated_at", "version"},
+			"properties": bson.M{
+				"name":             schemaString,
+				"contact":          schemaString,
+				"invitation_types": bson.M{"bsonType": "string", "minLength": 1},
+				"created_at":       schemaDate,
+				"updated_at":       schemaDate,
+				"version":          schemaVersion,
+				"deleted_at":       schemaDate,
+			},
+		},
+		"guests": {
+			"bsonType": "object",
+			"required": bson.A{"client_id", "name", "confirmation", "party_size", "created_at", "updated_at", "version"},
+			"properties": bson.M{
+				"client_id":         schemaObjectID,
+				"name":              schemaString,
+				"message":           schemaString,
+				"confirmation":      schemaStatus,
+				"message_status":    bson.M{"enum": bson.A{guest.MessagePending, guest.MessageApproved, guest.MessageHidden}},
+				"party_size":        schemaCount,
+				"plus_ones":         bson.M{"bsonType": "array", "items": schemaString},
+				"max_party_size":    schemaCount,
+				"responded_at":      schemaDate,
+				"invited_event_ids": bson.M{"bsonType": "array", "items": schemaObjectID},
+				"event_rsvps": bson.M{"bsonType": "array", "items": bson.M{
+					"bsonType": "object",
+					"required": bson.A{"event_id", "confirmation", "party_size"},
+					"properties": bson.M{
+						"event_id":     schemaObjectID,
+						"confirmation": schemaStatus,
+						"party_size":   schemaCount,
+						"responded_at": schemaDate,
+					},
+				}},
+				"phone":            schemaString,
+				"group":            schemaString,
+				"invitation_token": bson.M{"bsonType": "string", "minLength": 1},
+				"created_at":       schemaDate,
+				"updated_at":       schemaDate,
+				"version":          schemaVersion,
+				"deleted_at":       schemaDate,
+			},
+		},
+		"events": {
+			"bsonType": "object",
+			"required": bson.A{"client_id", "name", "starts_at", "ends_at", "created_at", "updated_at", "version"},
+			"properties": bson.M{
+				"client_id":  schemaObjectID,
+				"name":       bson.M{"bsonType": "string", "minLength": 1},
+				"starts_at":  schemaDate,
+				"ends_at":    schemaDate,
+				"time_zone":  schemaString,
+				"venue":      bson.M{"bsonType": "object"},
+				"dress_code": schemaString,
+				"capacity":   schemaCount,
+				"created_at": schemaDate,
+				"updated_at": schemaDate,
+				"version":    schemaVersion,
+			},
+		},
+	}
+	for collection, schema := range schemas {
+		if err := setValidator(ctx, db, collection, schema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createSlugIndex keeps two clients, trashed ones included, from sharing a slug; clients
+// without a slug are left out of the index
+func createSlugIndex(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db, "clients", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetName("slug_unique").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"slug": bson.M{"$type": "string"}})},
+	})
+}
+
+// createDomainIndex keeps two clients, trashed ones included, from registering the same custom
+// domain and serves the lookup of a site by its domain
+func createDomainIndex(ctx context.Context, db *mongo.Database) error {
+	return createIndexes(ctx, db, "clients", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "domains.host", Value: 1}}, Options: options.Index().SetName("domains_host_unique").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"domains.host": bson.M{"$exists": true}})},
+	})
+}
+
+// indexVerifiedHosts replaces the index of migration 7, under which a pending or failed claim,
+// or a trashed client, kept every other client from the name. Live clients now list their
+// verified domains in verified_hosts, and only that field is unique.
+func indexVerifiedHosts(ctx context.Context, db *mongo.Database) error {
+	clients := db.Collection("clients")
+	if err := dropIndex(ctx, clients, "domains_host_unique"); err != nil {
+		return err
+	}
+
+	backfillCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+	filter := trash.Live(bson.M{"domains.status": client.DomainVerified})
+	verifiedHosts := mongo.Pipeline{{{Key: "$set", Value: bson.M{"verified_hosts": bson.M{"$map": bson.M{
+		"input": bson.M{"$filter": bson.M{"input": "$domains", "cond": bson.M{"$eq": bson.A{"$$this.status", client.DomainVerified}}}},
+		"in":    "$$this.host",
+	}}}}}}
+	result, err := clients.UpdateMany(backfillCtx, filter, verifiedHosts)
+	if err != nil {
+		return err
+	}
+	log.Printf("Backfilled verified hosts on %d clients", result.ModifiedCount)
+
+	// The index serves the lookup of a site by its domain too; clients without a verified
+	// domain, including those with an empty list, are left out
+	return createIndexes(ctx, db, "clients", []mongo.IndexModel{
+		{Keys: bson.D{{Key: "verified_hosts", Value: 1}}, Options: options.Index().SetName("verified_hosts_unique").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"verified_hosts": bson.M{"$type": "string"}})},
+	})
+}
@@ -0,0 +1,107 @@
+// Package origins decides which browser origins may call the API: the platform domain and its
+// subdomains, a configured list, and the verified custom domains of the couples, which are
+// reloaded from the database periodically rather than on every request.
+package origins
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Load returns the verified custom domains, as bare host names
+type Load func(ctx context.Context) ([]string, error)
+
+// AllowList is a CORS allow-list that is safe for concurrent use
+type AllowList struct {
+	// domain is the platform domain, e.g. deiliinvitation.com
+	domain string
+	// static holds origins that are always allowed, e.g. http://localhost:3000
+	static map[string]bool
+	load   Load
+
+	mu sync.RWMutex
+	// custom holds the verified custom domains as of the last refresh
+	custom map[string]bool
+}
+
+// NewAllowList returns an allow-list of domain, its subdomains and the static origins. Custom
+// domains are only allowed once Refresh has loaded them.
+func NewAllowList(domain string, static []string, load Load) *AllowList {
+	a := &AllowList{
+		domain: strings.ToLower(strings.TrimSuffix(domain, ".")),
+		static: make(map[string]bool, len(static)),
+		load:   load,
+		custom: map[string]bool{},
+	}
+	for _, origin := range static {
+		a.static[strings.TrimRight(strings.ToLower(origin), "/")] = true
+	}
+	return a
+}
+
+// Allowed reports whether a browser page served from origin may call the API. Custom domains
+// are only trusted over HTTPS.
+func (a *AllowList) Allowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if a.static[origin] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := u.Hostname()
+	if host == a.domain {
+		return u.Scheme == "https"
+	}
+	if strings.HasSuffix(host, "."+a.domain) {
+		return u.Port() == ""
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return u.Scheme == "https" && u.Port() == "" && a.custom[host]
+}
+
+// Refresh reloads the custom domains; on failure the previous list stays in place
+func (a *AllowList) Refresh(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	hosts, err := a.load(ctx)
+	if err != nil {
+		return err
+	}
+	custom := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		custom[host] = true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.custom = custom
+	return nil
+}
+
+// Run refreshes the custom domains once every interval until ctx is cancelled, logging
+// failures rather than stopping
+func (a *AllowList) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.Refresh(ctx); err != nil {
+			log.Printf("Error refreshing the CORS allow-list: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package patch applies JSON Merge Patch documents (RFC 7396) to whitelisted views of stored
+// resources. The view's json tags are the only fields a patch may touch.
+package patch
+
+import (
+	"bytes"
+	"deili-backend/internal/apperror"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// ContentType is the media type of a merge patch request body
+const ContentType = "application/merge-patch+json"
+
+// Apply reads a merge patch from r and applies it to view, a pointer to a struct. Keys missing
+// from the patch keep their current value, null resets a field to its zero value and objects
+// are merged recursively. Keys that are not fields of view, and operator-like keys starting
+// with "$" or containing ".", are rejected.
+func Apply(view any, r io.Reader) error {
+	var raw any
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		return apperror.Validation("invalid merge patch: %v", err)
+	}
+	ops, ok := raw.(map[string]any)
+	if !ok {
+		return apperror.Validation("merge patch must be a JSON object")
+	}
+	if err := checkKeys("", ops); err != nil {
+		return err
+	}
+
+	current, err := toMap(view)
+	if err != nil {
+		return err
+	}
+	for key := range ops {
+		if _, known := current[key]; !known {
+			return apperror.InvalidField(key, "unknown field")
+		}
+	}
+
+	merged, err := json.Marshal(Merge(current, ops))
+	if err != nil {
+		return err
+	}
+
+	// Decode into a zeroed view so fields removed by null end up empty
+	target := reflect.ValueOf(view).Elem()
+	target.Set(reflect.Zero(target.Type()))
+	dec = json.NewDecoder(bytes.NewReader(merged))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(view); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return apperror.InvalidField(typeErr.Field, "must be a %s", typeErr.Type)
+		}
+		return apperror.Validation("invalid merge patch: %v", err)
+	}
+	return nil
+}
+
+// Merge applies patch to target following RFC 7396 and returns the result; target may be
+// modified in place
+func Merge(target, patch any) any {
+	ops, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	doc, ok := target.(map[string]any)
+	if !ok {
+		doc = map[string]any{}
+	}
+	for key, value := range ops {
+		if value == nil {
+			delete(doc, key)
+			continue
+		}
+		doc[key] = Merge(doc[key], value)
+	}
+	return doc
+}
+
+// checkKeys rejects keys that MongoDB would read as operators or paths
+func checkKeys(prefix string, doc map[string]any) error {
+	for key, value := range doc {
+		if strings.HasPrefix(key, "$") || strings.Contains(key, ".") {
+			return apperror.InvalidField(prefix+key, "field names cannot start with $ or contain .")
+		}
+		if nested, ok := value.(map[string]any); ok {
+			if err := checkKeys(prefix+key+".", nested); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// toMap converts the view to its JSON object form
+func toMap(view any) (map[string]any, error) {
+	raw, err := json.Marshal(view)
+	if err != nil {
+		return nil, fmt.Errorf("encoding patch target: %w", err)
+	}
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("encoding patch target: %w", err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,149 @@
+// Package ratelimit throttles public endpoints with in-memory token buckets and spots repeated
+// submissions. State is kept per process, so each API instance enforces its own limits.
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate allows Limit requests per Per, in bursts of up to Limit
+type Rate struct {
+	Limit int
+	Per   time.Duration
+}
+
+// ParseRate reads a rate written as "<limit>/<duration>", e.g. "10/1m"
+func ParseRate(value string) (Rate, error) {
+	limit, per, ok := strings.Cut(value, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("rate %q must look like 10/1m", value)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(limit))
+	if err != nil || n < 1 {
+		return Rate{}, fmt.Errorf("rate %q must allow at least one request", value)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(per))
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("rate %q must have a positive duration", value)
+	}
+	return Rate{Limit: n, Per: d}, nil
+}
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%d/%s", r.Limit, r.Per)
+}
+
+// bucket holds the tokens left for one key as of last
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a set of token buckets, one per key, refilled continuously at the same rate
+type Limiter struct {
+	rate Rate
+	now  func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// NewLimiter returns a limiter allowing rate per key
+func NewLimiter(rate Rate) *Limiter {
+	return &Limiter{rate: rate, now: time.Now, buckets: make(map[string]*bucket)}
+}
+
+// Allow takes a token for key. When the bucket is empty it reports false and how long until
+// the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	refill := float64(l.rate.Limit) / l.rate.Per.Seconds()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rate.Limit), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(float64(l.rate.Limit), b.tokens+now.Sub(b.last).Seconds()*refill)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / refill * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have refilled completely, which behave exactly like missing ones,
+// at most once per refill period; l.mu must be held
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.rate.Per {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.rate.Per {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Recent remembers keys for a time window, to spot the same submission sent twice
+type Recent struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewRecent returns a Recent remembering keys for window
+func NewRecent(window time.Duration) *Recent {
+	return &Recent{window: window, now: time.Now, seen: make(map[string]time.Time)}
+}
+
+// Seen records key and reports whether it was already recorded within the window
+func (r *Recent) Seen(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.sweep(now)
+
+	if at, ok := r.seen[key]; ok && now.Sub(at) < r.window {
+		return true
+	}
+	r.seen[key] = now
+	return false
+}
+
+// sweep drops the keys older than the window, at most once per window; r.mu must be held
+func (r *Recent) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < r.window {
+		return
+	}
+	r.lastSweep = now
+	for key, at := range r.seen {
+		if now.Sub(at) >= r.window {
+			delete(r.seen, key)
+		}
+	}
+}
+
+// Forget removes key, e.g. when the submission it stood for was not stored after all
+func (r *Recent) Forget(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.seen, key)
+}
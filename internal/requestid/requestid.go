@@ -0,0 +1,60 @@
+// Package requestid tags every request with an ID that is echoed in the response and recorded
+// alongside what the request changed, so a report from a user can be traced through the logs.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Header carries the request ID in both directions
+const Header = "X-Request-ID"
+
+// maxLength bounds IDs supplied by callers so they cannot bloat logs and audit entries
+const maxLength = 128
+
+type contextKey struct{}
+
+// Middleware reuses a well-formed X-Request-ID sent by the caller, for example by a proxy, or
+// generates a new one, and attaches it to the request context and the response
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = generate()
+		}
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, id)))
+	})
+}
+
+// FromContext returns the request ID, or "" outside of a request
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// valid accepts IDs made of letters, digits and the separators proxies commonly use
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// generate returns 16 random bytes as hex
+func generate() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,47 @@
+// Package revision versions documents for optimistic concurrency. Every update bumps a
+// document's version, and an update based on an older version than the stored one is refused,
+// so two people editing the same record cannot silently overwrite each other.
+package revision
+
+import (
+	"deili-backend/internal/apperror"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Field is the document field holding the version
+const Field = "version"
+
+// ErrConflict is returned by stores when a document changed after the version an update was
+// based on
+var ErrConflict = apperror.Conflict("the record was changed by another request, reload it and try again")
+
+// Now returns the time to stamp a write with, truncated to the millisecond precision MongoDB
+// stores, so the Mongo and memory stores hand out the same timestamps and documents written
+// together can later be matched by their exact time
+func Now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// Match restricts filter to documents at version and returns it. Documents stored before
+// versions existed have no version field and count as version 0.
+func Match(filter bson.M, version int64) bson.M {
+	if version == 0 {
+		filter[Field] = bson.M{"$in": bson.A{0, nil}}
+	} else {
+		filter[Field] = version
+	}
+	return filter
+}
+
+// Bump adds the version increment to update and returns it
+func Bump(update bson.M) bson.M {
+	inc, _ := update["$inc"].(bson.M)
+	if inc == nil {
+		inc = bson.M{}
+		update["$inc"] = inc
+	}
+	inc[Field] = 1
+	return update
+}
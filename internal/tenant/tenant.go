@@ -0,0 +1,182 @@
+// Package tenant works out which couple a request is for from the site it was sent from, so
+// pages served on a couple's subdomain, e.g. evelynandbenhard.deiliinvitation.com, or on their
+// verified custom domain do not need to know the client's ID.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// cacheTTL is how long a lookup is reused, including lookups that found no client
+	cacheTTL = time.Minute
+	// maxCacheEntries bounds the cache, which callers fill by picking hosts
+	maxCacheEntries = 10000
+)
+
+// Lookup returns the ID of the client with a slug or custom domain, or an error wrapping
+// mongo.ErrNoDocuments when there is none
+type Lookup func(ctx context.Context, key string) (primitive.ObjectID, error)
+
+// entry is a cached lookup; a zero id means no client has the slug or domain
+type entry struct {
+	id      primitive.ObjectID
+	expires time.Time
+}
+
+// Resolver maps the subdomains of one domain and custom domains to clients, caching the
+// lookups
+type Resolver struct {
+	domain   string
+	bySlug   Lookup
+	byDomain Lookup
+
+	mu sync.Mutex
+	// cache is keyed by slug or custom domain; slugs never contain a dot, so the two cannot clash
+	cache map[string]entry
+}
+
+// NewResolver returns a resolver for the subdomains of domain, e.g. "deiliinvitation.com",
+// looked up with bySlug, and for other hosts, looked up with byDomain
+func NewResolver(domain string, bySlug, byDomain Lookup) *Resolver {
+	return &Resolver{
+		domain:   strings.ToLower(strings.TrimSuffix(domain, ".")),
+		bySlug:   bySlug,
+		byDomain: byDomain,
+		cache:    make(map[string]entry),
+	}
+}
+
+type contextKey struct{}
+
+// WithClient returns a copy of ctx carrying the client a request is for
+func WithClient(ctx context.Context, id primitive.ObjectID) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the client the request was resolved to, if any
+func FromContext(ctx context.Context) (primitive.ObjectID, bool) {
+	id, ok := ctx.Value(contextKey{}).(primitive.ObjectID)
+	return id, ok && !id.IsZero()
+}
+
+// Middleware attaches the client of the site the request comes from to its context. The Host
+// header is tried first, for sites proxying the API under their own name, then the Origin
+// header, for pages calling the API across origins. Requests from anywhere else continue
+// without a client.
+func (r *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if id, ok := r.Resolve(req); ok {
+			req = req.WithContext(WithClient(req.Context(), id))
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// Resolve returns the client of the site req comes from
+func (r *Resolver) Resolve(req *http.Request) (primitive.ObjectID, bool) {
+	hosts := []string{req.Host}
+	if origin, err := url.Parse(req.Header.Get("Origin")); err == nil && origin.Host != "" {
+		hosts = append(hosts, origin.Host)
+	}
+	for _, host := range hosts {
+		var id primitive.ObjectID
+		var ok bool
+		if slug, isSubdomain := r.Slug(host); isSubdomain {
+			id, ok = r.client(req.Context(), slug, r.bySlug)
+		} else if host = normalizeHost(host); r.customDomain(host) {
+			id, ok = r.client(req.Context(), host, r.byDomain)
+		}
+		if ok {
+			return id, true
+		}
+	}
+	return primitive.NilObjectID, false
+}
+
+// normalizeHost strips the port and trailing dot from host and lowercases it
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// customDomain reports whether host, as returned by normalizeHost, could be a couple's custom
+// domain: a name of at least two labels outside the resolver's domain
+func (r *Resolver) customDomain(host string) bool {
+	return strings.Contains(host, ".") && net.ParseIP(host) == nil && host != r.domain && !strings.HasSuffix(host, "."+r.domain)
+}
+
+// Slug returns the subdomain label of host, which may carry a port, when host is a direct
+// subdomain of the resolver's domain
+func (r *Resolver) Slug(host string) (string, bool) {
+	host = normalizeHost(host)
+	label, ok := strings.CutSuffix(host, "."+r.domain)
+	if !ok || label == "" || strings.Contains(label, ".") {
+		return "", false
+	}
+	return label, true
+}
+
+// client looks up the client with the slug or custom domain key, from the cache when
+// possible. Failed lookups are logged and not cached, so the next request tries again.
+func (r *Resolver) client(ctx context.Context, key string, lookup Lookup) (primitive.ObjectID, bool) {
+	now := time.Now()
+	r.mu.Lock()
+	cached, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.id, !cached.id.IsZero()
+	}
+
+	id, err := lookup(ctx, key)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Error resolving site %q: %v", key, err)
+		return primitive.NilObjectID, false
+	}
+	if err != nil {
+		id = primitive.NilObjectID
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cache) >= maxCacheEntries {
+		r.sweep(now)
+	}
+	r.cache[key] = entry{id: id, expires: now.Add(cacheTTL)}
+	return id, !id.IsZero()
+}
+
+// sweep drops expired entries, or every entry when none has expired; r.mu must be held
+func (r *Resolver) sweep(now time.Time) {
+	for key, e := range r.cache {
+		if !now.Before(e.expires) {
+			delete(r.cache, key)
+		}
+	}
+	if len(r.cache) >= maxCacheEntries {
+		r.cache = make(map[string]entry)
+	}
+}
+
+// Forget drops the cached lookups of slugs or custom domains, e.g. after a client took or gave
+// up one
+func (r *Resolver) Forget(keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range keys {
+		delete(r.cache, key)
+	}
+}
@@ -0,0 +1,31 @@
+// Package trash holds the filters shared by stores that soft-delete documents. A deleted
+// document keeps its data and gets a deleted_at timestamp until it is restored or purged, and
+// every regular query leaves it out.
+package trash
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Field is the document field holding the deletion time
+const Field = "deleted_at"
+
+// Live restricts filter to documents that are not in the trash and returns it
+func Live(filter bson.M) bson.M {
+	filter[Field] = bson.M{"$exists": false}
+	return filter
+}
+
+// Only restricts filter to documents in the trash and returns it
+func Only(filter bson.M) bson.M {
+	filter[Field] = bson.M{"$exists": true}
+	return filter
+}
+
+// DeletedBefore restricts filter to documents moved to the trash before cutoff and returns it
+func DeletedBefore(filter bson.M, cutoff time.Time) bson.M {
+	filter[Field] = bson.M{"$lt": cutoff}
+	return filter
+}